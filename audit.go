@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+)
+
+// redactedValue 替换审计日志中被脱敏的字段的值
+const redactedValue = "<redacted>"
+
+// defaultAuditRedactFields 是默认脱敏的字段
+const defaultAuditRedactFields = "Secret:data,Secret:stringData"
+
+// auditLog 不为 nil 时记录 Reconciler 执行的每一次写操作，由 realMain 根据 --audit-log-path 创建
+var auditLog *auditLogger
+
+// redactRule 表示一个需要脱敏的字段，kind 为空时作用于所有资源
+type redactRule struct {
+	kind string
+	path []string
+}
+
+// parseRedactRules 函数解析 [Kind:]field.path 形式的脱敏字段列表，例如 Secret:data,spec.token
+func parseRedactRules(spec string) ([]redactRule, error) {
+	var rules []redactRule
+	for _, item := range splitList(spec) {
+		var rule redactRule
+		path := item
+		if kind, rest, ok := strings.Cut(item, ":"); ok {
+			rule.kind, path = strings.TrimSpace(kind), rest
+		}
+		for _, field := range strings.Split(path, ".") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				return nil, fmt.Errorf("无效的脱敏字段 %q，格式应为 [Kind:]field.path", item)
+			}
+			rule.path = append(rule.path, field)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// auditEntry 是审计日志中的一条记录。Diff 为写入前后对象的 JSON merge patch，创建时为完整的对象，删除时为 null。
+type auditEntry struct {
+	Time      time.Time       `json:"time"`
+	Key       string          `json:"key"`
+	Verb      string          `json:"verb"`
+	Kind      string          `json:"kind,omitempty"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Diff      json.RawMessage `json:"diff"`
+}
+
+// auditLogger 以 JSON Lines 格式将写操作记录到 out，每行一条 auditEntry
+type auditLogger struct {
+	rules []redactRule
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// newAuditLogger 函数创建一个写入 path 的 auditLogger，path 为 - 时写入标准输出，否则以追加方式写入文件。
+// 返回的 close 函数在退出前关闭审计日志文件。
+func newAuditLogger(path, redactSpec string) (logger *auditLogger, close func() error, err error) {
+	rules, err := parseRedactRules(redactSpec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if path == "-" {
+		return &auditLogger{rules: rules, out: os.Stdout}, func() error { return nil }, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开审计日志 %s 失败: %w", path, err)
+	}
+	return &auditLogger{rules: rules, out: f}, f.Close, nil
+}
+
+// record 函数记录一次成功的写操作。before 为 nil 表示创建，after 为 nil 表示删除。记录失败只输出错误日志，不影响写操作的结果。
+func (a *auditLogger) record(verb, key string, before, after runtime.Object) {
+	entry := auditEntry{Time: time.Now().UTC(), Key: key, Verb: verb}
+	for _, obj := range []runtime.Object{after, before} {
+		if obj == nil {
+			continue
+		}
+		entry.Kind = objectKind(obj)
+		if u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj); err == nil {
+			entry.Namespace, _, _ = unstructured.NestedString(u, "metadata", "namespace")
+			entry.Name, _, _ = unstructured.NestedString(u, "metadata", "name")
+		}
+		break
+	}
+
+	diff, err := a.diff(entry.Kind, before, after)
+	if err != nil {
+		klog.ErrorS(err, "failed to compute audit diff", "key", key, "verb", verb)
+		return
+	}
+	entry.Diff = diff
+	line, err := json.Marshal(entry)
+	if err != nil {
+		klog.ErrorS(err, "failed to encode audit entry", "key", key, "verb", verb)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.out.Write(append(line, '\n')); err != nil {
+		klog.ErrorS(err, "failed to write audit entry", "key", key, "verb", verb)
+	}
+}
+
+// diff 函数计算脱敏后的写入前后对象的 JSON merge patch
+func (a *auditLogger) diff(kind string, before, after runtime.Object) (json.RawMessage, error) {
+	if after == nil {
+		return json.RawMessage("null"), nil
+	}
+	afterJSON, err := a.sanitize(kind, after)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return afterJSON, nil
+	}
+	beforeJSON, err := a.sanitize(kind, before)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonpatch.CreateMergePatch(beforeJSON, afterJSON)
+	if err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+// sanitize 函数将对象转换为 JSON，去掉每次写入都会变化的 managedFields 和 resourceVersion，并将脱敏字段的值替换为 <redacted>。
+// 脱敏字段为 map 时只替换其中的值，保留键名，使审计日志仍能反映新增和删除的键。
+func (a *auditLogger) sanitize(kind string, obj runtime.Object) ([]byte, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	unstructured.RemoveNestedField(u, "metadata", "managedFields")
+	unstructured.RemoveNestedField(u, "metadata", "resourceVersion")
+	for _, rule := range a.rules {
+		if rule.kind != "" && rule.kind != kind {
+			continue
+		}
+		value, found, err := unstructured.NestedFieldNoCopy(u, rule.path...)
+		if err != nil || !found {
+			continue
+		}
+		if m, ok := value.(map[string]interface{}); ok {
+			for k := range m {
+				m[k] = redactedValue
+			}
+			continue
+		}
+		_ = unstructured.SetNestedField(u, redactedValue, rule.path...)
+	}
+	return json.Marshal(u)
+}
+
+// objectKind 函数返回对象的 Kind。clientset 返回的对象没有填写 TypeMeta，此时从 client-go 的 scheme 中查找。
+func objectKind(obj runtime.Object) string {
+	if kind := obj.GetObjectKind().GroupVersionKind().Kind; kind != "" {
+		return kind
+	}
+	gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+	if err != nil || len(gvks) == 0 {
+		return ""
+	}
+	return gvks[0].Kind
+}
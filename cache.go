@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic/dynamiclister"
+	"k8s.io/client-go/informers"
+)
+
+// ObjectCache 提供对控制器 informer 缓存的只读访问，lister 返回的对象与 informer 共享，调用方不能修改。
+type ObjectCache interface {
+	// InformerFactory 返回 cluster 集群中监听 namespace（集群级别的对象为空）的 SharedInformerFactory，
+	// Reconciler 从中获取类型化的 lister，例如 factory.Core().V1().Pods().Lister()。
+	// 只有被监听资源和 Dependencies 声明的资源的 informer 会被启动，其他资源的 lister 始终为空。
+	// 通过 dynamic client 监听资源或 namespace 不在监听范围内时返回 false。
+	InformerFactory(cluster, namespace string) (informers.SharedInformerFactory, bool)
+	// DynamicLister 返回 cluster 集群中监听 namespace 的被监听资源的 lister，对象为 *unstructured.Unstructured。
+	// 不是通过 dynamic client 监听资源或 namespace 不在监听范围内时返回 false。
+	DynamicLister(cluster, namespace string) (dynamiclister.Lister, bool)
+}
+
+// CacheInjector 可以由 Reconciler 实现，控制器创建 informer 之后调用 InjectCache 注入缓存，
+// 使 Reconciler 从缓存而不是 API Server 读取被监听的对象。
+type CacheInjector interface {
+	InjectCache(cache ObjectCache)
+}
+
+// InformerFactory 实现 ObjectCache，返回 cluster 集群中监听 namespace 的 SharedInformerFactory
+func (c *Controller) InformerFactory(cluster, namespace string) (informers.SharedInformerFactory, bool) {
+	ci, ok := c.informers[cluster]
+	if !ok {
+		return nil, false
+	}
+	s, ok := ci.scope(namespace)
+	if !ok {
+		return nil, false
+	}
+	return sharedInformerFactory(s.factory)
+}
+
+// DynamicLister 实现 ObjectCache，返回 cluster 集群中监听 namespace 的被监听资源的 dynamic lister
+func (c *Controller) DynamicLister(cluster, namespace string) (dynamiclister.Lister, bool) {
+	ci, ok := c.informers[cluster]
+	if !ok {
+		return nil, false
+	}
+	s, ok := ci.scope(namespace)
+	if !ok {
+		return nil, false
+	}
+	if _, typed := sharedInformerFactory(s.factory); typed {
+		return nil, false
+	}
+	return dynamiclister.New(s.informer.GetIndexer(), c.resource), true
+}
+
+// cachedGet 函数优先通过 cache 中 cluster 集群监听 namespace 的 SharedInformerFactory 读取对象，
+// cache 为 nil、不是类型化的 factory 或 fromCache 返回错误（例如缓存尚未同步时的 NotFound）时调用 live 从 API Server 读取。
+// 从缓存中读到的对象不能修改，需要修改时应先 DeepCopy。
+func cachedGet[T any](ctx context.Context, cache ObjectCache, cluster, namespace string, fromCache func(factory informers.SharedInformerFactory) (T, error), live func(ctx context.Context) (T, error)) (T, error) {
+	if cache != nil {
+		if factory, ok := cache.InformerFactory(cluster, namespace); ok {
+			if obj, err := fromCache(factory); err == nil {
+				return obj, nil
+			}
+		}
+	}
+	return live(ctx)
+}
+
+// cachedGetUnstructured 函数与 cachedGet 相同，但通过 DynamicLister 读取通过 dynamic client 监听的对象
+func cachedGetUnstructured(ctx context.Context, cache ObjectCache, cluster, namespace, name string, live func(ctx context.Context) (*unstructured.Unstructured, error)) (*unstructured.Unstructured, error) {
+	if cache != nil {
+		if lister, ok := cache.DynamicLister(cluster, namespace); ok {
+			get := lister.Get
+			if namespace != "" {
+				get = lister.Namespace(namespace).Get
+			}
+			if obj, err := get(name); err == nil {
+				return obj, nil
+			}
+		}
+	}
+	return live(ctx)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ownersOf 函数返回一个 MapFunc，通过子对象的 controller OwnerReference 在 parents 中查找其所属的被监听对象。
+// 所属对象可能是命名空间级别的（与子对象在同一个命名空间）或集群级别的，两种 key 依次查找；
+// UID 与 OwnerReference 不一致时说明是同名的其他对象，不会入队。
+func ownersOf(parents cache.Indexer) MapFunc {
+	return func(obj interface{}) []interface{} {
+		child, err := meta.Accessor(obj)
+		if err != nil {
+			return nil
+		}
+		ref := metav1.GetControllerOf(child)
+		if ref == nil {
+			return nil
+		}
+		keys := []string{ref.Name}
+		if child.GetNamespace() != "" {
+			keys = []string{child.GetNamespace() + "/" + ref.Name, ref.Name}
+		}
+		for _, key := range keys {
+			parent, exists, err := parents.GetByKey(key)
+			if err != nil || !exists {
+				continue
+			}
+			if parentMeta, err := meta.Accessor(parent); err == nil && parentMeta.GetUID() == ref.UID {
+				logV(componentInformer, 4).InfoS("child status changed, requeuing owner", "child", child.GetNamespace()+"/"+child.GetName(), "owner", key)
+				return []interface{}{parent}
+			}
+		}
+		return nil
+	}
+}
+
+// watchChildStatus 函数在子资源的 informer children 上注册事件处理函数：子对象的 status 发生变化或子对象被删除时，
+// 通过其 controller OwnerReference 在 parents 中找到所属的对象并通过 enqueue 入队，用于父对象的状态依赖子对象的场景。
+// 子对象新增时 status 通常为空，父对象本身也会因为创建子对象而更新，因此不处理新增事件。必须在 children 启动之前调用。
+func watchChildStatus(children, parents cache.SharedIndexInformer, enqueue func(obj interface{})) error {
+	owners := ownersOf(parents.GetIndexer())
+	handle := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		for _, owner := range owners(obj) {
+			enqueue(owner)
+		}
+	}
+	_, err := children.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if StatusChangedPredicate.UpdateFunc(oldObj, newObj) {
+				handle(newObj)
+			}
+		},
+		DeleteFunc: handle,
+	})
+	if err != nil {
+		return fmt.Errorf("注册子资源事件处理函数失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sync/atomic"
+
+	clientset "k8s.io/client-go/kubernetes"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// clientHolder 持有一个可以在运行时原子替换的 clientset，例如收到 SIGHUP 后重新加载 kubeconfig。
+// reconcile 逻辑应在每次请求时通过 Get 获取最新的 clientset，而不是长期持有某个 clientset。
+// 注意：已经启动的 informer 会继续使用创建时的 clientset。
+type clientHolder struct {
+	v atomic.Value
+}
+
+// clientBox 用于在 atomic.Value 中存放不同具体类型的 clientset.Interface
+type clientBox struct {
+	client clientset.Interface
+}
+
+// newClientHolder 函数创建一个持有 client 的 clientHolder
+func newClientHolder(client clientset.Interface) *clientHolder {
+	h := &clientHolder{}
+	h.Set(client)
+	return h
+}
+
+// Get 返回当前的 clientset
+func (h *clientHolder) Get() clientset.Interface {
+	return h.v.Load().(clientBox).client
+}
+
+// Set 替换当前的 clientset
+func (h *clientHolder) Set(client clientset.Interface) {
+	h.v.Store(clientBox{client: client})
+}
+
+// homeClient 在每次调用时通过 clusterSet.Home 获取租约锁所在集群当前的 clientset。
+// 资源锁、租约优先级、领导权变更记录和事件 sink 会在整个运行期间持有 getter，
+// 使用 homeClient 后收到 SIGHUP 重新加载 kubeconfig 时这些对象随之使用新的凭据，续约不会因旧凭据失效而失去领导权。
+type homeClient struct {
+	clusters *clusterSet
+}
+
+// Leases 返回租约锁所在集群中 namespace 的 LeaseInterface
+func (c homeClient) Leases(namespace string) coordinationv1client.LeaseInterface {
+	return c.clusters.Home().CoordinationV1().Leases(namespace)
+}
+
+// ConfigMaps 返回租约锁所在集群中 namespace 的 ConfigMapInterface
+func (c homeClient) ConfigMaps(namespace string) corev1client.ConfigMapInterface {
+	return c.clusters.Home().CoreV1().ConfigMaps(namespace)
+}
+
+// Endpoints 返回租约锁所在集群中 namespace 的 EndpointsInterface
+func (c homeClient) Endpoints(namespace string) corev1client.EndpointsInterface {
+	return c.clusters.Home().CoreV1().Endpoints(namespace)
+}
+
+// Events 返回租约锁所在集群中 namespace 的 EventInterface
+func (c homeClient) Events(namespace string) corev1client.EventInterface {
+	return c.clusters.Home().CoreV1().Events(namespace)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/dynamic"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// clusterSource 描述如何连接一个集群：kubeconfig 文件路径以及要使用的 context 名称
+type clusterSource struct {
+	kubeconfig string
+	context    string
+}
+
+// clusterSet 保存控制器连接的所有集群。
+// 单集群模式下只有一个名称为空的集群，工作队列中的 key 为 namespace/name；
+// 多集群模式下每个集群以其 kubeconfig context 名称命名，key 为 cluster%namespace/name。
+type clusterSet struct {
+	// names 为按配置顺序排列的集群名称
+	names   []string
+	clients map[string]*clientHolder
+	sources map[string]clusterSource
+	// dynamicClients 为每个集群的 dynamic client，只在启动时创建，重新加载 kubeconfig 时不会替换
+	dynamicClients map[string]dynamic.Interface
+	// home 为租约锁所在的集群
+	home string
+	// qps 和 burst 为重新创建 clientset 时使用的限速参数
+	qps   float32
+	burst int
+}
+
+// splitList 函数将逗号分隔的字符串拆分为列表，忽略空白项。
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseClusterSources 函数解析 --kubeconfig 和 --context 参数：
+// kubeconfig 可以是逗号分隔的多个文件，每个文件使用其当前 context；
+// 也可以是单个文件配合逗号分隔的多个 context。
+func parseClusterSources(kubeconfig, contexts string) ([]clusterSource, error) {
+	paths := splitList(kubeconfig)
+	names := splitList(contexts)
+	if len(paths) > 1 && len(names) > 0 {
+		return nil, fmt.Errorf("--context 只能与单个 kubeconfig 文件一起使用")
+	}
+
+	if len(paths) > 1 {
+		sources := make([]clusterSource, 0, len(paths))
+		for _, path := range paths {
+			sources = append(sources, clusterSource{kubeconfig: path})
+		}
+		return sources, nil
+	}
+
+	var path string
+	if len(paths) == 1 {
+		path = paths[0]
+	}
+	if len(names) == 0 {
+		return []clusterSource{{kubeconfig: path}}, nil
+	}
+	sources := make([]clusterSource, 0, len(names))
+	for _, name := range names {
+		sources = append(sources, clusterSource{kubeconfig: path, context: name})
+	}
+	return sources, nil
+}
+
+// newClusterSet 函数为每个 clusterSource 创建 clientset。只有一个集群时使用单集群模式，leaseCluster 被忽略；
+// 多个集群时 leaseCluster 指定租约锁所在的集群，为空时使用第一个集群。
+// 连接 API Server 失败时最多重试 retryTimeout。
+func newClusterSet(sources []clusterSource, leaseCluster string, qps float32, burst int, retryTimeout time.Duration) (*clusterSet, error) {
+	s := &clusterSet{
+		clients: make(map[string]*clientHolder, len(sources)),
+		sources: make(map[string]clusterSource, len(sources)),
+		qps:     qps,
+		burst:   burst,
+	}
+
+	if len(sources) == 1 {
+		if leaseCluster != "" {
+			klog.Warningf("只连接了一个集群，忽略 --lease-cluster=%s", leaseCluster)
+		}
+		client, err := connectWithRetry(sources[0].kubeconfig, sources[0].context, qps, burst, retryTimeout)
+		if err != nil {
+			return nil, err
+		}
+		s.add("", sources[0], client)
+		if err := s.addDynamic(""); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	for _, source := range sources {
+		name, err := contextName(source.kubeconfig, source.context)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := s.clients[name]; ok {
+			return nil, fmt.Errorf("集群名称 %q 重复，每个集群的 context 名称必须唯一", name)
+		}
+		client, err := connectWithRetry(source.kubeconfig, source.context, qps, burst, retryTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("连接集群 %s 失败: %w", name, err)
+		}
+		s.add(name, source, client)
+		if err := s.addDynamic(name); err != nil {
+			return nil, fmt.Errorf("连接集群 %s 失败: %w", name, err)
+		}
+	}
+
+	s.home = s.names[0]
+	if leaseCluster != "" {
+		if _, ok := s.clients[leaseCluster]; !ok {
+			return nil, fmt.Errorf("--lease-cluster 指定的集群 %q 不存在，可选值为 %s", leaseCluster, strings.Join(s.names, ","))
+		}
+		s.home = leaseCluster
+	}
+	klog.InfoS("multi-cluster mode", "clusters", s.names, "leaseCluster", s.home)
+	return s, nil
+}
+
+// add 函数向集合中添加一个集群
+func (s *clusterSet) add(name string, source clusterSource, client clientset.Interface) {
+	s.names = append(s.names, name)
+	s.clients[name] = newClientHolder(client)
+	s.sources[name] = source
+}
+
+// addDynamic 函数为名称为 name 的集群创建 dynamic client
+func (s *clusterSet) addDynamic(name string) error {
+	source := s.sources[name]
+	client, err := newDynamicClient(source.kubeconfig, source.context, s.qps, s.burst)
+	if err != nil {
+		return err
+	}
+	if s.dynamicClients == nil {
+		s.dynamicClients = make(map[string]dynamic.Interface, len(s.names))
+	}
+	s.dynamicClients[name] = client
+	return nil
+}
+
+// Dynamic 返回名称为 name 的集群的 dynamic client，用于读写任意资源（包括 CRD）
+func (s *clusterSet) Dynamic(name string) dynamic.Interface {
+	return s.dynamicClients[name]
+}
+
+// multi 返回是否处于多集群模式
+func (s *clusterSet) multi() bool {
+	return len(s.names) > 1
+}
+
+// isHome 返回 name 是否为租约锁所在的集群，单集群模式下唯一的集群即为 home 集群
+func (s *clusterSet) isHome(name string) bool {
+	return name == s.home
+}
+
+// Client 返回名称为 name 的集群当前的 clientset
+func (s *clusterSet) Client(name string) clientset.Interface {
+	return s.clients[name].Get()
+}
+
+// Home 返回租约锁所在集群当前的 clientset
+func (s *clusterSet) Home() clientset.Interface {
+	return s.Client(s.home)
+}
+
+// reload 函数重新构建所有集群的 clientset，某个集群失败时记录错误并继续使用该集群原有的 clientset。
+func (s *clusterSet) reload() {
+	for _, name := range s.names {
+		source := s.sources[name]
+		client, err := newClientset(source.kubeconfig, source.context, s.qps, s.burst)
+		if err != nil {
+			klog.ErrorS(err, "重新加载 kubeconfig 失败，继续使用原有的客户端", "cluster", name)
+			continue
+		}
+		s.clients[name].Set(client)
+		klog.InfoS("kubeconfig 重新加载完成", "cluster", name)
+	}
+}
+
+// clusterKeySeparator 分隔 key 中的集群名称和对象 key。context 名称可以包含任意字符（例如 EKS 的 ARN 中带有 /），
+// 而 Kubernetes 对象的名称和命名空间不能包含 %，因此以 key 中最后一个 % 为界拆分总是无歧义的。
+const clusterKeySeparator = "%"
+
+// clusterKey 函数为 namespace/name（集群级别的对象为 name）形式的 key 加上集群前缀，cluster 为空时原样返回。
+// 它与 splitClusterKey 互为逆运算。
+func clusterKey(cluster, key string) string {
+	if cluster == "" {
+		return key
+	}
+	return cluster + clusterKeySeparator + key
+}
+
+// splitClusterKey 函数将 cluster%namespace/name 形式的 key 拆分为集群名称和 namespace/name，
+// 没有集群前缀时 cluster 为空。
+func splitClusterKey(key string) (cluster, objectKey string) {
+	if i := strings.LastIndex(key, clusterKeySeparator); i >= 0 {
+		return key[:i], key[i+len(clusterKeySeparator):]
+	}
+	return "", key
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+func TestClusterKeyRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		cluster   string
+		objectKey string
+		key       string
+	}{
+		{name: "single cluster namespaced", cluster: "", objectKey: "default/web", key: "default/web"},
+		{name: "single cluster cluster-scoped", cluster: "", objectKey: "node-1", key: "node-1"},
+		{name: "namespaced", cluster: "prod", objectKey: "default/web", key: "prod%default/web"},
+		{name: "cluster-scoped", cluster: "prod", objectKey: "node-1", key: "prod%node-1"},
+		{name: "context with slashes", cluster: "arn:aws:eks:us-east-1:123456789012:cluster/prod", objectKey: "default/web", key: "arn:aws:eks:us-east-1:123456789012:cluster/prod%default/web"},
+		{name: "context with slashes cluster-scoped", cluster: "arn:aws:eks:us-east-1:123456789012:cluster/prod", objectKey: "node-1", key: "arn:aws:eks:us-east-1:123456789012:cluster/prod%node-1"},
+		{name: "context with separator", cluster: "team%prod", objectKey: "default/web", key: "team%prod%default/web"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clusterKey(tt.cluster, tt.objectKey); got != tt.key {
+				t.Errorf("clusterKey(%q, %q) = %q, want %q", tt.cluster, tt.objectKey, got, tt.key)
+			}
+			cluster, objectKey := splitClusterKey(tt.key)
+			if cluster != tt.cluster || objectKey != tt.objectKey {
+				t.Errorf("splitClusterKey(%q) = (%q, %q), want (%q, %q)", tt.key, cluster, objectKey, tt.cluster, tt.objectKey)
+			}
+		})
+	}
+}
+
+func TestHomeClientFollowsReload(t *testing.T) {
+	before := fake.NewSimpleClientset()
+	clusters := newTestClusterSet(before)
+	lock, err := newResourceLock(lockTypeLease, "first-controller", "kube-system", "a", homeClient{clusters: clusters})
+	if err != nil {
+		t.Fatalf("newResourceLock() error = %v", err)
+	}
+
+	// 模拟 SIGHUP 重新加载 kubeconfig 后替换了主集群的 clientset
+	after := fake.NewSimpleClientset()
+	clusters.clients[clusters.home].Set(after)
+	now := metav1.NewTime(time.Now())
+	if err := lock.Create(context.Background(), resourcelock.LeaderElectionRecord{HolderIdentity: "a", LeaseDurationSeconds: 15, AcquireTime: now, RenewTime: now}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if _, err := after.CoordinationV1().Leases("kube-system").Get(context.Background(), "first-controller", metav1.GetOptions{}); err != nil {
+		t.Errorf("lease not written with the reloaded client: %v", err)
+	}
+	if leases, _ := before.CoordinationV1().Leases("kube-system").List(context.Background(), metav1.ListOptions{}); len(leases.Items) != 0 {
+		t.Errorf("lease written with the old client")
+	}
+}
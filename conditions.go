@@ -0,0 +1,49 @@
+package main
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// conditionReady 是表示资源已经完成 reconcile 的 condition 类型
+const conditionReady = "Ready"
+
+// SetCondition 函数在 conditions 中设置 cond.Type 类型的 condition，已存在时更新，否则追加，返回 conditions 是否发生了变化。
+// 只有 Status 变化时才更新 LastTransitionTime；cond 没有填写 LastTransitionTime 时使用当前时间。
+func SetCondition(conditions *[]metav1.Condition, cond metav1.Condition) (changed bool) {
+	if cond.LastTransitionTime.IsZero() {
+		cond.LastTransitionTime = metav1.Now()
+	}
+	existing := GetCondition(*conditions, cond.Type)
+	if existing == nil {
+		*conditions = append(*conditions, cond)
+		return true
+	}
+	if existing.Status != cond.Status {
+		existing.Status = cond.Status
+		existing.LastTransitionTime = cond.LastTransitionTime
+		changed = true
+	}
+	if existing.Reason != cond.Reason {
+		existing.Reason = cond.Reason
+		changed = true
+	}
+	if existing.Message != cond.Message {
+		existing.Message = cond.Message
+		changed = true
+	}
+	if existing.ObservedGeneration != cond.ObservedGeneration {
+		existing.ObservedGeneration = cond.ObservedGeneration
+		changed = true
+	}
+	return changed
+}
+
+// GetCondition 函数返回 conditions 中 conditionType 类型的 condition，不存在时返回 nil。返回的指针指向 conditions 中的元素。
+func GetCondition(conditions []metav1.Condition, conditionType string) *metav1.Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
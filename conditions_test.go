@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetCondition(t *testing.T) {
+	before := metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	after := metav1.NewTime(before.Add(time.Hour))
+	existing := metav1.Condition{
+		Type:               conditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Pending",
+		Message:            "waiting",
+		ObservedGeneration: 1,
+		LastTransitionTime: before,
+	}
+
+	tests := []struct {
+		name           string
+		conditions     []metav1.Condition
+		cond           metav1.Condition
+		wantChanged    bool
+		wantTransition metav1.Time
+	}{
+		{
+			name:           "append new condition",
+			cond:           metav1.Condition{Type: conditionReady, Status: metav1.ConditionTrue, Reason: "Reconciled", LastTransitionTime: after},
+			wantChanged:    true,
+			wantTransition: after,
+		},
+		{
+			name:           "unchanged condition",
+			conditions:     []metav1.Condition{existing},
+			cond:           withTransitionTime(existing, after),
+			wantChanged:    false,
+			wantTransition: before,
+		},
+		{
+			name:        "status change updates transition time",
+			conditions:  []metav1.Condition{existing},
+			cond:        metav1.Condition{Type: conditionReady, Status: metav1.ConditionTrue, Reason: "Pending", Message: "waiting", ObservedGeneration: 1, LastTransitionTime: after},
+			wantChanged: true,
+			// Status 变化时使用新的 LastTransitionTime
+			wantTransition: after,
+		},
+		{
+			name:           "reason change keeps transition time",
+			conditions:     []metav1.Condition{existing},
+			cond:           metav1.Condition{Type: conditionReady, Status: metav1.ConditionFalse, Reason: "Failed", Message: "waiting", ObservedGeneration: 1, LastTransitionTime: after},
+			wantChanged:    true,
+			wantTransition: before,
+		},
+		{
+			name:           "message change keeps transition time",
+			conditions:     []metav1.Condition{existing},
+			cond:           metav1.Condition{Type: conditionReady, Status: metav1.ConditionFalse, Reason: "Pending", Message: "still waiting", ObservedGeneration: 1, LastTransitionTime: after},
+			wantChanged:    true,
+			wantTransition: before,
+		},
+		{
+			name:           "observed generation change keeps transition time",
+			conditions:     []metav1.Condition{existing},
+			cond:           metav1.Condition{Type: conditionReady, Status: metav1.ConditionFalse, Reason: "Pending", Message: "waiting", ObservedGeneration: 2, LastTransitionTime: after},
+			wantChanged:    true,
+			wantTransition: before,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditions := append([]metav1.Condition(nil), tt.conditions...)
+			if changed := SetCondition(&conditions, tt.cond); changed != tt.wantChanged {
+				t.Errorf("SetCondition() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if len(conditions) != 1 {
+				t.Fatalf("len(conditions) = %d, want 1", len(conditions))
+			}
+			got := GetCondition(conditions, conditionReady)
+			if got == nil {
+				t.Fatalf("GetCondition() = nil")
+			}
+			if !got.LastTransitionTime.Equal(&tt.wantTransition) {
+				t.Errorf("LastTransitionTime = %v, want %v", got.LastTransitionTime, tt.wantTransition)
+			}
+			if got.Status != tt.cond.Status || got.Reason != tt.cond.Reason || got.Message != tt.cond.Message || got.ObservedGeneration != tt.cond.ObservedGeneration {
+				t.Errorf("condition = %+v, want fields from %+v", *got, tt.cond)
+			}
+		})
+	}
+}
+
+func TestSetConditionDefaultsTransitionTime(t *testing.T) {
+	var conditions []metav1.Condition
+	SetCondition(&conditions, metav1.Condition{Type: conditionReady, Status: metav1.ConditionTrue})
+	if got := GetCondition(conditions, conditionReady); got == nil || got.LastTransitionTime.IsZero() {
+		t.Errorf("LastTransitionTime not defaulted: %+v", got)
+	}
+}
+
+func withTransitionTime(cond metav1.Condition, t metav1.Time) metav1.Condition {
+	cond.LastTransitionTime = t
+	return cond
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config 是 --config-file 指定的 YAML 配置文件的内容。键为驼峰形式的命令行参数名，例如 leaseDuration 对应 --lease-duration、
+// watchNamespace 对应 --watch-namespace；值为标量，列表会以逗号连接后作为参数值。
+type Config map[string]interface{}
+
+// loadConfig 函数读取并解析 path 指定的 YAML 配置文件
+func loadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// flagName 函数将驼峰形式的配置项名转换为命令行参数名，例如 leaseDuration 转换为 lease-duration
+func flagName(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// configValue 函数将配置项的值转换为命令行参数值
+func configValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := configValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("不支持的值类型 %T", v)
+	}
+}
+
+// validate 函数检查每个配置项都对应 fs 中的一个参数并且值合法，返回所有问题。
+func (c Config) validate(fs *flag.FlagSet) error {
+	var problems []string
+	for _, key := range c.keys() {
+		name := flagName(key)
+		if name == "config-file" {
+			problems = append(problems, fmt.Sprintf("%s: 配置文件中不能再指定配置文件", key))
+			continue
+		}
+		if fs.Lookup(name) == nil {
+			problems = append(problems, fmt.Sprintf("%s: 未知的配置项", key))
+			continue
+		}
+		if _, err := configValue(c[key]); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("配置文件不合法：\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// apply 函数将配置项设置到 fs 中对应的参数上，命令行中显式指定的参数优先，不会被配置文件覆盖。
+// 参数值的解析与命令行相同，例如 duration 类型的参数需要写成 "15s"。
+func (c Config) apply(fs *flag.FlagSet) error {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	for _, key := range c.keys() {
+		name := flagName(key)
+		if explicit[name] {
+			continue
+		}
+		value, err := configValue(c[key])
+		if err != nil {
+			return fmt.Errorf("配置项 %s 不合法: %w", key, err)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("配置项 %s 的值 %q 不合法: %w", key, value, err)
+		}
+	}
+	return nil
+}
+
+// keys 函数返回排序后的配置项名，使配置的应用顺序和错误信息稳定
+func (c Config) keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
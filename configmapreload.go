@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// watchConfigMapLabel 标记需要在内容变化时触发引用它的 Deployment 滚动更新的 ConfigMap
+	watchConfigMapLabel = "first-controller.io/watch"
+	// checksumAnnotation 记录 Deployment 引用的被监听 ConfigMap 内容的 SHA256，写在 Pod 模板上以触发滚动更新
+	checksumAnnotation = "first-controller.io/checksum"
+	// configMapDependencyIndex 是 Deployment informer 上按引用的 ConfigMap 建立的索引
+	configMapDependencyIndex = "configmaps"
+)
+
+// ConfigMapReloadReconciler 监听 Deployment 及其引用的 ConfigMap（volume、projected volume、envFrom 和 env 中的 configMapKeyRef），
+// 计算其中带有 first-controller.io/watch=true 标签的 ConfigMap 内容的 SHA256，写入 Pod 模板的 first-controller.io/checksum 注解。
+// ConfigMap 内容变化时校验和随之变化，从而触发 Deployment 滚动更新。
+type ConfigMapReloadReconciler struct {
+	clusters *clusterSet
+	// cache 为控制器的 informer 缓存，为 nil 时直接从 API Server 读取
+	cache ObjectCache
+	// dryRun 为 true 时只记录将要执行的 patch 而不实际执行
+	dryRun bool
+}
+
+// NewConfigMapReloadReconciler 函数创建一个 ConfigMapReloadReconciler
+func NewConfigMapReloadReconciler(clusters *clusterSet, dryRun bool) *ConfigMapReloadReconciler {
+	return &ConfigMapReloadReconciler{clusters: clusters, dryRun: dryRun}
+}
+
+// Informer 返回 Deployment 的 informer，使控制器监听 Deployment
+func (r *ConfigMapReloadReconciler) Informer(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+	return factory.Apps().V1().Deployments().Informer()
+}
+
+// InjectCache 设置读取 Deployment 及其引用的 ConfigMap 使用的 informer 缓存
+func (r *ConfigMapReloadReconciler) InjectCache(cache ObjectCache) {
+	r.cache = cache
+}
+
+// Resource 返回 Deployment 的 GroupVersionResource
+func (r *ConfigMapReloadReconciler) Resource() schema.GroupVersionResource {
+	return appsv1.SchemeGroupVersion.WithResource("deployments")
+}
+
+// RequiredPermissions 返回 ConfigMapReloadReconciler 需要的权限
+func (r *ConfigMapReloadReconciler) RequiredPermissions(namespace string) []authorizationv1.ResourceAttributes {
+	return append(resourcePermissions(namespace, "apps", "deployments", "get", "list", "watch", "patch"),
+		resourcePermissions(namespace, "", "configmaps", "get", "list", "watch")...)
+}
+
+// Dependencies 声明 Deployment 对 ConfigMap 的依赖，ConfigMap 变化时重新处理引用它的 Deployment
+func (r *ConfigMapReloadReconciler) Dependencies() []Dependency {
+	return []Dependency{{
+		Name: configMapDependencyIndex,
+		Informer: func(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+			return factory.Core().V1().ConfigMaps().Informer()
+		},
+		Index: func(obj interface{}) ([]string, error) {
+			deploy, ok := obj.(*appsv1.Deployment)
+			if !ok {
+				return nil, nil
+			}
+			names := referencedConfigMaps(&deploy.Spec.Template.Spec)
+			keys := make([]string, 0, len(names))
+			for _, name := range names {
+				keys = append(keys, deploy.Namespace+"/"+name)
+			}
+			return keys, nil
+		},
+	}}
+}
+
+// Reconcile 将 key 对应 Deployment 的校验和注解更新为其引用的被监听 ConfigMap 的当前内容
+func (r *ConfigMapReloadReconciler) Reconcile(ctx context.Context, key string) (Result, error) {
+	return Result{}, r.reconcile(ctx, key)
+}
+
+// reconcile 函数执行 Reconcile 的实际逻辑，ConfigMap 的变化由依赖索引触发，因此从不要求重新入队
+func (r *ConfigMapReloadReconciler) reconcile(ctx context.Context, key string) error {
+	cluster, objectKey := splitClusterKey(key)
+	namespace, name, err := cache.SplitMetaNamespaceKey(objectKey)
+	if err != nil {
+		return err
+	}
+
+	client := r.clusters.Client(cluster)
+	deployments := client.AppsV1().Deployments(namespace)
+	deploy, err := cachedGet(ctx, r.cache, cluster, namespace, func(factory informers.SharedInformerFactory) (*appsv1.Deployment, error) {
+		return factory.Apps().V1().Deployments().Lister().Deployments(namespace).Get(name)
+	}, func(ctx context.Context) (*appsv1.Deployment, error) {
+		return deployments.Get(ctx, name, metav1.GetOptions{})
+	})
+	if apierrors.IsNotFound(err) {
+		// Deployment 已被删除，无需处理
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	getConfigMap := r.configMapGetter(client, cluster, namespace)
+	var watched []*corev1.ConfigMap
+	for _, cmName := range referencedConfigMaps(&deploy.Spec.Template.Spec) {
+		cm, err := getConfigMap(ctx, cmName)
+		if apierrors.IsNotFound(err) {
+			// 引用的 ConfigMap 可能是 optional 的，创建后会通过依赖索引重新触发
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Labels[watchConfigMapLabel] == "true" {
+			watched = append(watched, cm)
+		}
+	}
+
+	current, annotated := deploy.Spec.Template.Annotations[checksumAnnotation]
+	var desired interface{}
+	if len(watched) > 0 {
+		checksum := configMapChecksum(watched)
+		if annotated && current == checksum {
+			return nil
+		}
+		desired = checksum
+	} else if !annotated {
+		return nil
+	}
+	// desired 为 nil 时 patch 会删除不再引用被监听 ConfigMap 的 Deployment 上的注解
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]interface{}{checksumAnnotation: desired},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	klog.InfoS("updating deployment config checksum", "key", key, "checksum", desired, "configmaps", len(watched))
+	return guardedWrite(r.dryRun, "patch deployment config checksum", key, deploy, func() (runtime.Object, error) {
+		return deployments.Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	})
+}
+
+// configMapGetter 函数返回读取 namespace 中 ConfigMap 的函数：优先使用 Dependencies 注册的 ConfigMap informer 的 lister，
+// 未注入缓存或该 informer 尚未完成初始同步（此时 lister 的 NotFound 不可信）时直接请求 API Server。
+func (r *ConfigMapReloadReconciler) configMapGetter(client clientset.Interface, cluster, namespace string) func(ctx context.Context, name string) (*corev1.ConfigMap, error) {
+	if r.cache != nil {
+		if factory, ok := r.cache.InformerFactory(cluster, namespace); ok {
+			configMaps := factory.Core().V1().ConfigMaps()
+			if configMaps.Informer().HasSynced() {
+				lister := configMaps.Lister().ConfigMaps(namespace)
+				return func(_ context.Context, name string) (*corev1.ConfigMap, error) {
+					return lister.Get(name)
+				}
+			}
+		}
+	}
+	return func(ctx context.Context, name string) (*corev1.ConfigMap, error) {
+		return client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	}
+}
+
+// referencedConfigMaps 函数返回 Pod 模板通过 volume、projected volume、envFrom 和 env 引用的 ConfigMap 名称，已排序且去重
+func referencedConfigMaps(spec *corev1.PodSpec) []string {
+	names := sets.New[string]()
+	for _, v := range spec.Volumes {
+		if v.ConfigMap != nil {
+			names.Insert(v.ConfigMap.Name)
+		}
+		if v.Projected != nil {
+			for _, source := range v.Projected.Sources {
+				if source.ConfigMap != nil {
+					names.Insert(source.ConfigMap.Name)
+				}
+			}
+		}
+	}
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		for _, from := range c.EnvFrom {
+			if from.ConfigMapRef != nil {
+				names.Insert(from.ConfigMapRef.Name)
+			}
+		}
+		for _, env := range c.Env {
+			if env.ValueFrom != nil && env.ValueFrom.ConfigMapKeyRef != nil {
+				names.Insert(env.ValueFrom.ConfigMapKeyRef.Name)
+			}
+		}
+	}
+	return sets.List(names)
+}
+
+// configMapChecksum 函数计算 ConfigMap 名称和内容（data 与 binaryData）的 SHA256，结果与 map 的遍历顺序无关
+func configMapChecksum(configMaps []*corev1.ConfigMap) string {
+	sorted := append([]*corev1.ConfigMap{}, configMaps...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	h := sha256.New()
+	for _, cm := range sorted {
+		fmt.Fprintf(h, "configmap %q\n", cm.Name)
+		for _, k := range sets.List(sets.KeySet(cm.Data)) {
+			fmt.Fprintf(h, "data %q %q\n", k, cm.Data[k])
+		}
+		for _, k := range sets.List(sets.KeySet(cm.BinaryData)) {
+			fmt.Fprintf(h, "binaryData %q %x\n", k, cm.BinaryData[k])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,619 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// ControllerOptions 是创建 Controller 时的可选配置
+type ControllerOptions struct {
+	// Namespace 为控制器监听的命名空间，为空表示监听所有命名空间
+	Namespace string
+	// NamespaceSelector 不为 nil 时只监听标签匹配的命名空间，并随命名空间的增删动态调整，与 Namespace 互斥
+	NamespaceSelector labels.Selector
+	// LabelSelector 和 FieldSelector 不为 nil 时只监听匹配的对象，由 API Server 在 list/watch 时过滤
+	LabelSelector labels.Selector
+	FieldSelector fields.Selector
+	// ResyncPeriod 为 informer 的全量重新同步周期，为 0 时不进行周期性同步
+	ResyncPeriod time.Duration
+	// FullSyncPeriod 为从 API Server 全量列出对象并与缓存比较的周期，用于发现丢失的事件，为 0 时关闭
+	FullSyncPeriod time.Duration
+	// InformerStartupConcurrency 限制同时启动并进行初始同步的 informer 数量，为 0 时不限制
+	InformerStartupConcurrency int
+	// RequireResource 为 true 时被监听的资源（例如 CRD）不存在时 Run 立即返回错误，否则等待资源出现
+	RequireResource bool
+	// ReconcileTimeout 为单次 reconcile 的最长执行时间，为 0 时不限制
+	ReconcileTimeout time.Duration
+	// ShutdownTimeout 为停止时等待处理中的任务完成的最长时间
+	ShutdownTimeout time.Duration
+	// MaxRetries 为 reconcile 失败后的最大重试次数，超过后丢弃该任务并记录事件
+	MaxRetries int
+	// DisableCacheReads 为 true 时不向实现了 CacheInjector 的 Reconciler 注入缓存，Reconciler 直接从 API Server 读取对象
+	DisableCacheReads bool
+	// KeyFunc 用于计算放入工作队列的对象 key，为 nil 时使用 cache.DeletionHandlingMetaNamespaceKeyFunc。
+	// 多集群模式下控制器会在 KeyFunc 的结果前加上集群前缀。
+	KeyFunc func(obj interface{}) (string, error)
+	// SplitKey 是 KeyFunc 的逆运算，将 key 拆分为 namespace 和 name，为 nil 时使用 cache.SplitMetaNamespaceKey。
+	SplitKey func(key string) (namespace, name string, err error)
+	// ShardFilter 不为 nil 时只处理 ShardFilter 返回 true 的 key，用于分片模式下只处理当前实例持有的分片
+	ShardFilter func(key string) bool
+	// WatchErrorThreshold 大于 0 时，WatchErrorWindow 内 informer 的 list/watch 错误次数达到该值时 WatchHealthy 返回 false
+	WatchErrorThreshold int
+	WatchErrorWindow    time.Duration
+	// InformerMaxErrorDuration 大于 0 时，list/watch 错误持续超过该时间的 informer 会被丢弃并重新创建，为 0 时只依赖 reflector 的重试
+	InformerMaxErrorDuration time.Duration
+	// CacheSyncTimeout 大于 0 时，informer 缓存超过该时间仍未完成初始同步则记录未同步的 informer，控制器继续等待同步
+	CacheSyncTimeout time.Duration
+	// DynamicResource 不为空时通过 dynamic client 监听该资源，缓存中的对象为 *unstructured.Unstructured，
+	// 可以在不修改代码的情况下监听任意资源（包括 CRD）。不能与实现了 InformerProvider 的 Reconciler 一起使用。
+	DynamicResource schema.GroupVersionResource
+	// ChildStatusResource 不为空时通过 dynamic client 监听该子资源，子对象的 status 发生变化或子对象被删除时，
+	// 将其 controller OwnerReference 指向的被监听对象入队。子资源与被监听资源在相同的命名空间中监听，但不使用标签和字段选择器。
+	ChildStatusResource schema.GroupVersionResource
+	// ReconcileDebounce 大于 0 时，informer 事件触发的 key 在该时间之后才被处理，期间同一个 key 的后续事件合并为一次 reconcile
+	ReconcileDebounce time.Duration
+	// Predicates 在 informer 事件入队之前过滤事件，所有 Predicate 都返回 true 时才入队，为空时所有事件都入队。
+	// 只作用于被监听资源的事件，被依赖资源的事件、全量同步和重新入队不受影响。
+	Predicates []Predicate
+	// MaxConcurrentPerNamespace 大于 0 时同一个命名空间中最多同时处理该数量的 key，超出的 key 稍后重新入队，为 0 时不限制。
+	// 多集群模式下每个集群的命名空间分别计数，集群级别的对象共用一个名额。
+	MaxConcurrentPerNamespace int
+	// ExcludeNamespaces 中的命名空间里的对象在入队时被跳过，用于避免监听所有命名空间的控制器处理控制面的对象
+	ExcludeNamespaces []string
+	// StablePeriod 大于 0 时 Run 在缓存完成同步后继续等待，直到 Run 启动后至少经过 StablePeriod 才启动 worker。
+	// 在 OnStartedLeading 中调用 Run 时即要求连续持有领导权达到该时间，失去领导权时 ctx 被取消，下一次调用 Run 重新计时。
+	StablePeriod time.Duration
+	// OnPanic 不为 nil 时在 Reconciler 处理 key 发生 panic 后调用，调用时 panic 已经被恢复
+	OnPanic func(key string)
+}
+
+// Controller 是一个基于 SharedInformer 的控制器：
+// 事件处理函数将对象的 key 放入工作队列，worker 从队列中取出 key 并交给 Reconciler 处理。
+// 默认监听 Pod，Reconciler 实现了 InformerProvider 时监听其指定的资源。
+// 多集群模式下每个集群各有一组 informer，所有集群共享同一个工作队列。
+type Controller struct {
+	clusters   *clusterSet
+	informers  map[string]*clusterInformers
+	queue      workqueue.RateLimitingInterface
+	recorder   record.EventRecorder
+	reconciler Reconciler
+	keyFunc    func(obj interface{}) (string, error)
+	splitKey   func(key string) (namespace, name string, err error)
+
+	// resource 为被监听的资源，requireResource 为 true 时资源不存在立即失败
+	resource         schema.GroupVersionResource
+	requireResource  bool
+	informerOpts     informerOptions
+	fullSyncPeriod   time.Duration
+	reconcileTimeout time.Duration
+	shutdownTimeout  time.Duration
+	maxRetries       int
+	cacheSyncTimeout time.Duration
+	shardFilter      func(key string) bool
+	watchErrors      *watchErrorTracker
+	onPanic          func(key string)
+	debounce         time.Duration
+	stablePeriod     time.Duration
+	excluded         sets.Set[string]
+	nsLimiter        *namespaceLimiter
+
+	// syncing 在 Run 启动 informer 到缓存完成初始同步之间为 true
+	syncing atomic.Bool
+}
+
+// NewController 函数创建一个 Controller 并为每个集群注册事件处理函数，informer 在调用 Run 时才会启动。
+func NewController(clusters *clusterSet, recorder record.EventRecorder, reconciler Reconciler, opts ControllerOptions) (*Controller, error) {
+	if opts.Namespace != metav1.NamespaceAll && opts.NamespaceSelector != nil {
+		return nil, fmt.Errorf("不能同时指定监听的命名空间和命名空间标签选择器")
+	}
+
+	c := &Controller{
+		clusters:         clusters,
+		informers:        make(map[string]*clusterInformers, len(clusters.names)),
+		queue:            workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: workqueueName}),
+		recorder:         recorder,
+		reconciler:       reconciler,
+		keyFunc:          opts.KeyFunc,
+		splitKey:         opts.SplitKey,
+		resource:         corev1.SchemeGroupVersion.WithResource("pods"),
+		requireResource:  opts.RequireResource,
+		fullSyncPeriod:   opts.FullSyncPeriod,
+		reconcileTimeout: opts.ReconcileTimeout,
+		shutdownTimeout:  opts.ShutdownTimeout,
+		maxRetries:       opts.MaxRetries,
+		cacheSyncTimeout: opts.CacheSyncTimeout,
+		shardFilter:      opts.ShardFilter,
+		watchErrors:      newWatchErrorTracker(opts.WatchErrorThreshold, opts.WatchErrorWindow),
+		onPanic:          opts.OnPanic,
+		debounce:         opts.ReconcileDebounce,
+		stablePeriod:     opts.StablePeriod,
+		excluded:         sets.New(opts.ExcludeNamespaces...),
+		nsLimiter:        newNamespaceLimiter(opts.MaxConcurrentPerNamespace),
+	}
+
+	if c.keyFunc == nil {
+		c.keyFunc = cache.DeletionHandlingMetaNamespaceKeyFunc
+	}
+	if c.splitKey == nil {
+		c.splitKey = cache.SplitMetaNamespaceKey
+	}
+
+	informerFor := func(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return factory.Core().V1().Pods().Informer()
+	}
+	provider, provided := reconciler.(InformerProvider)
+	if provided {
+		informerFor = provider.Informer
+		c.resource = provider.Resource()
+	}
+	var deps []Dependency
+	if p, ok := reconciler.(DependencyProvider); ok {
+		deps = p.Dependencies()
+	}
+	dynamicMode := !opts.DynamicResource.Empty()
+	if dynamicMode {
+		if provided {
+			return nil, fmt.Errorf("reconciler %T 指定了自己监听的资源，不能同时通过 dynamic client 监听 %s", reconciler, opts.DynamicResource)
+		}
+		c.resource = opts.DynamicResource
+	}
+
+	c.informerOpts = informerOptions{
+		namespace:     opts.Namespace,
+		selector:      opts.NamespaceSelector,
+		labelSelector: opts.LabelSelector,
+		fieldSelector: opts.FieldSelector,
+		resyncPeriod:  opts.ResyncPeriod,
+		watchErrors:   c.watchErrors,
+		resource:      c.resource.GroupResource().String(),
+
+		maxErrorDuration: opts.InformerMaxErrorDuration,
+	}
+	if opts.InformerStartupConcurrency > 0 {
+		c.informerOpts.startupSem = make(chan struct{}, opts.InformerStartupConcurrency)
+	}
+
+	for _, cluster := range clusters.names {
+		cluster := cluster
+		filter := predicates(opts.Predicates)
+		handler := cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if filter.create(obj) {
+					c.enqueue(cluster, obj)
+				}
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				if filter.update(oldObj, newObj) {
+					c.enqueue(cluster, newObj)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				if filter.delete(obj) {
+					c.enqueue(cluster, obj)
+				}
+			},
+		}
+		client := clusters.Client(cluster)
+		enqueue := func(obj interface{}) {
+			c.enqueue(cluster, obj)
+		}
+		newInformer := func(namespace string) (informerFactory, cache.SharedIndexInformer, error) {
+			factory := newInformerFactory(client, namespace, c.informerOpts)
+			informer := informerFor(factory)
+			if len(deps) > 0 {
+				if err := watchDependencies(factory, informer, deps, enqueue); err != nil {
+					return nil, nil, err
+				}
+			}
+			return factory, informer, nil
+		}
+		if dynamicMode {
+			dynamicClient := clusters.Dynamic(cluster)
+			newInformer = func(namespace string) (informerFactory, cache.SharedIndexInformer, error) {
+				factory := newDynamicInformerFactory(dynamicClient, namespace, c.informerOpts)
+				return factory, factory.ForResource(c.resource).Informer(), nil
+			}
+		}
+		if child := opts.ChildStatusResource; !child.Empty() {
+			newParentInformer := newInformer
+			dynamicClient := clusters.Dynamic(cluster)
+			newInformer = func(namespace string) (informerFactory, cache.SharedIndexInformer, error) {
+				factory, informer, err := newParentInformer(namespace)
+				if err != nil {
+					return nil, nil, err
+				}
+				childFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, c.informerOpts.resyncPeriod, namespace, nil)
+				if err := watchChildStatus(childFactory.ForResource(child).Informer(), informer, enqueue); err != nil {
+					return nil, nil, err
+				}
+				return informerFactories{factory, childFactory}, informer, nil
+			}
+		}
+		ci, err := newClusterInformers(cluster, client, c.informerOpts, newInformer, handler)
+		if err != nil {
+			return nil, err
+		}
+		c.informers[cluster] = ci
+	}
+
+	if injector, ok := reconciler.(CacheInjector); ok && !opts.DisableCacheReads {
+		injector.InjectCache(c)
+	}
+	return c, nil
+}
+
+// Run 函数启动 informer，等待缓存同步后启动 workers 个 worker，并阻塞直到 ctx 取消。
+// ctx 取消后停止接收新任务，并最多等待 shutdownTimeout 让处理中的任务完成。
+func (c *Controller) Run(ctx context.Context, workers int) error {
+	defer c.queue.ShutDown()
+	started := time.Now()
+
+	stop, err := c.startInformers(ctx)
+	if stop != nil {
+		defer stop()
+	}
+	if err != nil && ctx.Err() != nil {
+		// 等待资源或缓存同步期间 ctx 被取消，正常退出
+		return nil
+	}
+	if err != nil || stop == nil {
+		return err
+	}
+	if remaining := c.stablePeriod - time.Since(started); remaining > 0 {
+		// 等待期间 informer 继续同步，事件照常入队，worker 启动后再处理
+		klog.InfoS("waiting for stable period before starting workers", "remaining", remaining)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(remaining):
+		}
+	}
+
+	// background 记录 Run 启动的所有后台 goroutine，Run 返回前等待它们全部退出
+	var background sync.WaitGroup
+	defer background.Wait()
+	if c.fullSyncPeriod > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			c.runFullSync(ctx, c.fullSyncPeriod)
+		}()
+	}
+
+	// 排空队列期间处理中的任务仍需要访问 API Server，因此 reconcile 使用的 context 不随 ctx 取消，
+	// 只在等待超过 shutdownTimeout 后取消，使仍在执行的 API 调用尽快返回
+	reconcileCtx, cancelReconcile := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelReconcile()
+
+	// 所有 worker 共享同一个工作队列，因此限速器也是共享的
+	klog.Infof("启动 %d 个 worker", workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.UntilWithContext(ctx, func(context.Context) { c.runWorker(reconcileCtx) }, time.Second)
+		}()
+	}
+
+	<-ctx.Done()
+	klog.Info("停止接收新任务，等待处理中的任务完成")
+	c.queue.ShutDown()
+	workersDone := waitDone(&wg)
+	if !waitTimeout(workersDone, c.shutdownTimeout) {
+		klog.Warningf("等待处理中的任务超时 (%s)，取消剩余任务", c.shutdownTimeout)
+		cancelReconcile()
+		if !waitTimeout(workersDone, c.shutdownTimeout) {
+			klog.Warningf("取消后处理中的任务仍未退出，Reconciler 可能没有响应 context 的取消")
+		}
+	}
+	return nil
+}
+
+// startInformers 函数等待被监听的资源可用后启动所有 informer，并阻塞直到缓存完成初始同步。
+// 返回的 stop 函数等待所有 informer 退出，调用前需要先取消 ctx；等待资源期间 ctx 被取消时 stop 和错误均为 nil。
+func (c *Controller) startInformers(ctx context.Context) (stop func(), err error) {
+	for _, cluster := range c.clusters.names {
+		if err := waitForResource(ctx, cluster, c.clusters.Client(cluster).Discovery(), c.resource, c.requireResource); err != nil {
+			if ctx.Err() != nil {
+				// 等待期间收到终止信号，正常退出
+				return nil, nil
+			}
+			return nil, err
+		}
+	}
+
+	c.syncing.Store(true)
+	defer c.syncing.Store(false)
+	synced := make([]cache.InformerSynced, 0, len(c.informers))
+	for _, ci := range c.informers {
+		ci.start(ctx)
+		synced = append(synced, ci.hasSynced)
+	}
+	stop = func() {
+		for _, ci := range c.informers {
+			ci.shutdown()
+		}
+	}
+
+	klog.Info("等待缓存同步")
+	syncDone := make(chan struct{})
+	if c.cacheSyncTimeout > 0 {
+		go c.reportSyncTimeout(syncDone)
+	}
+	ok := cache.WaitForCacheSync(ctx.Done(), synced...)
+	close(syncDone)
+	if !ok {
+		// WaitForCacheSync 只在 ctx 取消时返回 false
+		return stop, fmt.Errorf("等待缓存同步失败: %w", ctx.Err())
+	}
+	logV(componentInformer, 2).InfoS("caches synced", "clusters", len(c.informers))
+	return stop, nil
+}
+
+// Syncing 返回控制器是否已经启动但 informer 缓存尚未完成初始同步，此时控制器不应被视为就绪
+func (c *Controller) Syncing() bool {
+	return c.syncing.Load()
+}
+
+// WatchHealthy 返回 informer 最近的 list/watch 错误次数是否低于阈值，持续的 watch 错误说明缓存可能已经过期
+func (c *Controller) WatchHealthy() bool {
+	return c.watchErrors.healthy()
+}
+
+// reportSyncTimeout 函数在 cacheSyncTimeout 内 done 没有关闭时记录所有尚未完成初始同步的 informer
+func (c *Controller) reportSyncTimeout(done <-chan struct{}) {
+	timer := time.NewTimer(c.cacheSyncTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+	for _, cluster := range c.clusters.names {
+		for _, namespace := range c.informers[cluster].unsynced() {
+			klog.ErrorS(nil, "informer cache not synced within timeout", "cluster", cluster, "namespace", namespace, "resource", c.resource.String(), "timeout", c.cacheSyncTimeout)
+		}
+	}
+}
+
+// runWorker 函数持续处理工作队列中的任务，直到队列关闭。ctx 用于 reconcile，取消时处理中的 API 调用随之返回。
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+// enqueue 函数通过 keyFunc 计算对象的 key 并放入工作队列，多集群模式下 key 带有集群前缀。
+func (c *Controller) enqueue(cluster string, obj interface{}) {
+	key, err := c.keyFunc(obj)
+	if err != nil {
+		klog.Errorf("计算对象 key 失败: %v", err)
+		return
+	}
+	if c.excluded.Len() > 0 {
+		if namespace, _, err := c.splitKey(key); err == nil && c.excluded.Has(namespace) {
+			logV(componentInformer, 6).InfoS("skip object in excluded namespace", "key", key)
+			return
+		}
+	}
+	key = clusterKey(cluster, key)
+	if c.shardFilter != nil && !c.shardFilter(key) {
+		return
+	}
+	logV(componentInformer, 5).InfoS("enqueue object", "key", key)
+	if c.debounce > 0 {
+		// 同一个 key 已经在等待时 AddAfter 只保留较早的时间，因此后续事件既不会延长等待，也不会重复入队
+		c.queue.AddAfter(key, c.debounce)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// requeueAll 函数将所有集群 informer 缓存中的对象重新入队
+func (c *Controller) requeueAll() {
+	for cluster, ci := range c.informers {
+		for _, informer := range ci.informers() {
+			for _, obj := range informer.GetStore().List() {
+				c.enqueue(cluster, obj)
+			}
+		}
+	}
+}
+
+// processNextItem 函数从工作队列中取出一个 key 并交给 Reconciler 处理，队列关闭时返回 false。
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	item, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(item)
+
+	key := item.(string)
+	if c.shardFilter != nil && !c.shardFilter(key) {
+		// 入队之后失去了该 key 所属分片的领导权，由新的持有者处理
+		c.queue.Forget(key)
+		return true
+	}
+	if c.nsLimiter != nil {
+		namespace := c.limiterNamespace(key)
+		if !c.nsLimiter.tryAcquire(namespace) {
+			// 所属命名空间的并发已满，稍后重新入队；这不是失败，不计入重试次数
+			logV(componentReconcile, 5).InfoS("namespace concurrency limit reached, requeuing", "key", key, "namespace", namespace)
+			c.queue.AddAfter(key, namespaceThrottleDelay)
+			return true
+		}
+		defer c.nsLimiter.release(namespace)
+	}
+	ctx, span := tracer().Start(ctx, "reconcile", trace.WithAttributes(attribute.String("key", key)))
+	if c.reconcileTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.reconcileTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	logV(componentReconcile, 4).InfoS("reconcile started", "key", key)
+	result, err := c.reconcile(ctx, key)
+	duration := time.Since(start)
+	logV(componentReconcile, 4).InfoS("reconcile finished", "key", key, "duration", duration, "err", err)
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	observeWithTraceExemplar(reconcileDuration.WithLabelValues(outcome), span.SpanContext(), duration.Seconds())
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.SetAttributes(attribute.String("outcome", outcome))
+	span.End()
+
+	if err != nil {
+		// 超时说明 API Server 响应缓慢或调用被挂起，与其他失败一样按退避重试并受最大重试次数限制；
+		// Reconciler 在截止时间前已经成功返回时不视为超时
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			klog.Warningf("reconcile %s 超时 (%s)，稍后重试", key, c.reconcileTimeout)
+		}
+		c.handleErr(err, key)
+		return true
+	}
+	c.handleResult(result, key)
+	return true
+}
+
+// limiterNamespace 函数返回 key 在命名空间并发限制中所属的分组，即带集群前缀的命名空间
+func (c *Controller) limiterNamespace(key string) string {
+	cluster, objectKey := splitClusterKey(key)
+	namespace, _, err := c.splitKey(objectKey)
+	if err != nil {
+		namespace = ""
+	}
+	return clusterKey(cluster, namespace)
+}
+
+// reconcile 函数调用 Reconciler 处理 key，并将 Reconciler 中的 panic 转换为错误，使该 key 按指数退避重试而不是使整个进程崩溃。
+// 这里不使用 utilruntime.HandleCrash，因为它在默认配置下会重新抛出 panic。
+func (c *Controller) reconcile(ctx context.Context, key string) (result Result, err error) {
+	ctx = withReconcileLogger(ctx, key)
+	defer func() {
+		if r := recover(); r != nil {
+			reconcilePanics.Inc()
+			klog.ErrorS(nil, "observed a panic in reconcile", "key", key, "panic", r, "stack", string(debug.Stack()))
+			err = fmt.Errorf("reconcile %s 时发生 panic: %v", key, r)
+			if c.onPanic != nil {
+				c.onPanic(key)
+			}
+		}
+	}()
+	return c.reconciler.Reconcile(ctx, key)
+}
+
+// handleResult 函数处理成功的 reconcile 返回的 Result：RequeueAfter 大于 0 时在该时间后重新入队，
+// Requeue 为 true 时按指数退避重新入队，否则清除该 key 的重试记录。
+func (c *Controller) handleResult(result Result, key string) {
+	switch {
+	case result.RequeueAfter > 0:
+		// 延迟重新入队不是失败，清除重试记录以免影响之后的退避时间
+		c.queue.Forget(key)
+		logV(componentReconcile, 4).InfoS("requeue after", "key", key, "after", result.RequeueAfter)
+		c.queue.AddAfter(key, result.RequeueAfter)
+	case result.Requeue:
+		logV(componentReconcile, 4).InfoS("requeue", "key", key)
+		c.queue.AddRateLimited(key)
+	default:
+		c.queue.Forget(key)
+	}
+}
+
+// handleErr 函数处理 reconcile 的结果：成功时清除该 key 的重试记录；失败时按指数退避重新入队，
+// 超过最大重试次数后丢弃该 key 并在对应对象上记录一个 Warning 事件。终止性错误不重试，直接丢弃并记录事件。
+func (c *Controller) handleErr(err error, key string) {
+	if err == nil {
+		c.queue.Forget(key)
+		return
+	}
+
+	if IsTerminalError(err) {
+		// 终止性错误重试也不会成功，例如对象的 spec 本身不合法，直接丢弃，等待对象被修改后重新触发
+		c.queue.Forget(key)
+		klog.ErrorS(err, "reconcile failed with terminal error, dropping key", "key", key)
+		c.recordFailure(key, "reconcile failed with terminal error: %v", err)
+		return
+	}
+
+	retries := c.queue.NumRequeues(key)
+	if retries < c.maxRetries {
+		klog.ErrorS(err, "reconcile failed, requeuing", "key", key, "retries", retries)
+		c.queue.AddRateLimited(key)
+		return
+	}
+
+	c.queue.Forget(key)
+	klog.ErrorS(err, "reconcile failed too many times, dropping key", "key", key, "retries", retries)
+	c.recordFailure(key, "reconcile failed after %d retries: %v", retries, err)
+}
+
+// recordFailure 函数在 key 对应的对象上记录一个 ReconcileFailed Warning 事件。
+func (c *Controller) recordFailure(key, messageFmt string, args ...interface{}) {
+	// 事件只能记录到租约锁所在集群，其他集群的对象只记录日志
+	cluster, objectKey := splitClusterKey(key)
+	if !c.clusters.isHome(cluster) {
+		return
+	}
+	namespace, name, splitErr := c.splitKey(objectKey)
+	if splitErr != nil {
+		klog.ErrorS(splitErr, "failed to split key", "key", key)
+		return
+	}
+	if obj, exists, getErr := c.informers[cluster].get(namespace, name); getErr == nil && exists {
+		if o, ok := obj.(runtime.Object); ok {
+			c.recorder.Eventf(o, corev1.EventTypeWarning, eventReasonReconcileFailed, messageFmt, args...)
+		}
+	}
+}
+
+// waitDone 函数返回一个在 wg 完成后关闭的 channel，多次等待同一个 wg 时应复用该 channel。
+// 等待 wg 的 goroutine 在 wg 中最后一个 goroutine 退出时随之退出：超时返回后它只会与仍未退出的 worker 存活同样长的时间，
+// 不会在 worker 全部退出后继续泄漏。
+func waitDone(wg *sync.WaitGroup) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// waitTimeout 函数等待 done 关闭，最多等待 timeout，超时返回 false。
+func waitTimeout(done <-chan struct{}, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
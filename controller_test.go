@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/goleak"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// newTestClusterSet 函数创建一个只包含 client 的单集群 clusterSet
+func newTestClusterSet(client clientset.Interface) *clusterSet {
+	s := &clusterSet{
+		clients: map[string]*clientHolder{},
+		sources: map[string]clusterSource{},
+	}
+	s.add("", clusterSource{}, client)
+	return s
+}
+
+// reconcilerFunc 将函数适配为 Reconciler
+type reconcilerFunc func(ctx context.Context, key string) (Result, error)
+
+func (f reconcilerFunc) Reconcile(ctx context.Context, key string) (Result, error) {
+	return f(ctx, key)
+}
+
+func newTestController(t *testing.T, reconciler Reconciler) *Controller {
+	t.Helper()
+	c, err := NewController(newTestClusterSet(fake.NewSimpleClientset()), record.NewFakeRecorder(10), reconciler, ControllerOptions{
+		MaxRetries: 5,
+	})
+	if err != nil {
+		t.Fatalf("NewController() error = %v", err)
+	}
+	t.Cleanup(c.queue.ShutDown)
+	return c
+}
+
+func TestProcessNextItemRequeuesOnError(t *testing.T) {
+	reconcileErr := errors.New("boom")
+	c := newTestController(t, reconcilerFunc(func(context.Context, string) (Result, error) {
+		return Result{}, reconcileErr
+	}))
+
+	const key = "default/foo"
+	c.queue.Add(key)
+	if !c.processNextItem(context.Background()) {
+		t.Fatal("processNextItem() = false, want true")
+	}
+	if got := c.queue.NumRequeues(key); got != 1 {
+		t.Errorf("NumRequeues(%q) = %d, want 1", key, got)
+	}
+}
+
+func TestProcessNextItemForgetsOnSuccess(t *testing.T) {
+	var reconciled []string
+	c := newTestController(t, reconcilerFunc(func(_ context.Context, key string) (Result, error) {
+		reconciled = append(reconciled, key)
+		return Result{}, nil
+	}))
+
+	const key = "default/foo"
+	c.queue.AddRateLimited(key)
+	c.queue.Add(key)
+	if !c.processNextItem(context.Background()) {
+		t.Fatal("processNextItem() = false, want true")
+	}
+	if got := c.queue.NumRequeues(key); got != 0 {
+		t.Errorf("NumRequeues(%q) = %d, want 0", key, got)
+	}
+	if len(reconciled) != 1 || reconciled[0] != key {
+		t.Errorf("reconciled = %v, want [%s]", reconciled, key)
+	}
+}
+
+func TestProcessNextItemRequeuesAfter(t *testing.T) {
+	c := newTestController(t, reconcilerFunc(func(context.Context, string) (Result, error) {
+		return Result{RequeueAfter: 10 * time.Millisecond}, nil
+	}))
+
+	const key = "default/foo"
+	c.queue.AddRateLimited(key)
+	c.queue.Add(key)
+	if !c.processNextItem(context.Background()) {
+		t.Fatal("processNextItem() = false, want true")
+	}
+	if got := c.queue.NumRequeues(key); got != 0 {
+		t.Errorf("NumRequeues(%q) = %d, want 0", key, got)
+	}
+	if got := c.queue.Len(); got != 0 {
+		t.Errorf("queue.Len() = %d immediately after reconcile, want 0", got)
+	}
+	if err := wait.PollUntilContextTimeout(context.Background(), time.Millisecond, time.Second, true, func(context.Context) (bool, error) {
+		return c.queue.Len() == 1, nil
+	}); err != nil {
+		t.Errorf("key was not requeued after RequeueAfter: %v", err)
+	}
+}
+
+func TestProcessNextItemDoesNotRetryTerminalError(t *testing.T) {
+	calls := 0
+	c := newTestController(t, reconcilerFunc(func(context.Context, string) (Result, error) {
+		calls++
+		return Result{}, TerminalError(errors.New("malformed spec"))
+	}))
+
+	const key = "default/foo"
+	c.queue.Add(key)
+	if !c.processNextItem(context.Background()) {
+		t.Fatal("processNextItem() = false, want true")
+	}
+	if got := c.queue.NumRequeues(key); got != 0 {
+		t.Errorf("NumRequeues(%q) = %d, want 0", key, got)
+	}
+	if got := c.queue.Len(); got != 0 {
+		t.Errorf("queue.Len() = %d, want 0", got)
+	}
+	if calls != 1 {
+		t.Errorf("reconcile called %d times, want 1", calls)
+	}
+}
+
+func TestProcessNextItemTimeoutHonoursMaxRetries(t *testing.T) {
+	c := newTestController(t, reconcilerFunc(func(ctx context.Context, _ string) (Result, error) {
+		<-ctx.Done()
+		return Result{}, ctx.Err()
+	}))
+	c.reconcileTimeout = time.Millisecond
+
+	const key = "default/foo"
+	for i := 0; i < c.maxRetries; i++ {
+		c.queue.AddRateLimited(key)
+	}
+	c.queue.Add(key)
+	if !c.processNextItem(context.Background()) {
+		t.Fatal("processNextItem() = false, want true")
+	}
+	// 重试次数已经达到 MaxRetries，超时后丢弃该 key 而不是继续重试
+	if got := c.queue.NumRequeues(key); got != 0 {
+		t.Errorf("NumRequeues(%q) = %d, want 0", key, got)
+	}
+}
+
+func TestProcessNextItemSuccessAtDeadlineIsNotTimeout(t *testing.T) {
+	c := newTestController(t, reconcilerFunc(func(ctx context.Context, _ string) (Result, error) {
+		<-ctx.Done()
+		return Result{}, nil
+	}))
+	c.reconcileTimeout = time.Millisecond
+
+	const key = "default/foo"
+	c.queue.Add(key)
+	if !c.processNextItem(context.Background()) {
+		t.Fatal("processNextItem() = false, want true")
+	}
+	if got := c.queue.NumRequeues(key); got != 0 {
+		t.Errorf("NumRequeues(%q) = %d, want 0", key, got)
+	}
+}
+
+func TestReconcilePanicDoesNotStopWorker(t *testing.T) {
+	reconciled := make(chan string, 1)
+	c := newTestController(t, reconcilerFunc(func(_ context.Context, key string) (Result, error) {
+		if key == "default/panic" {
+			panic("buggy reconciler")
+		}
+		reconciled <- key
+		return Result{}, nil
+	}))
+	panicsBefore := testutil.ToFloat64(reconcilePanics)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.runWorker(context.Background())
+	}()
+	c.queue.Add("default/panic")
+	c.queue.Add("default/ok")
+
+	select {
+	case key := <-reconciled:
+		if key != "default/ok" {
+			t.Errorf("reconciled %q, want default/ok", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("worker stopped processing after a reconciler panic")
+	}
+	// 发生 panic 的 key 按指数退避重试，检查时可能已经重试过，因此只要求至少一次
+	if got := c.queue.NumRequeues("default/panic"); got < 1 {
+		t.Errorf("NumRequeues(default/panic) = %d, want at least 1", got)
+	}
+	if got := testutil.ToFloat64(reconcilePanics) - panicsBefore; got < 1 {
+		t.Errorf("controller_reconcile_panics_total increased by %v, want at least 1", got)
+	}
+
+	c.queue.ShutDown()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("runWorker() did not return after the queue was shut down")
+	}
+}
+
+func TestRunReturnsWhenContextCancelled(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	client := fake.NewSimpleClientset(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"}})
+	client.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{{Name: "pods", Namespaced: true, Kind: "Pod"}},
+	}}
+	started := make(chan struct{})
+	// Reconciler 一直阻塞到 ctx 取消，模拟一个挂起的 API 调用
+	c, err := NewController(newTestClusterSet(client), record.NewFakeRecorder(10), reconcilerFunc(func(ctx context.Context, _ string) (Result, error) {
+		close(started)
+		<-ctx.Done()
+		return Result{}, ctx.Err()
+	}), ControllerOptions{
+		MaxRetries:      5,
+		ShutdownTimeout: 100 * time.Millisecond,
+		FullSyncPeriod:  time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewController() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx, 2) }()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconcile was not started")
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() error = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after the context was cancelled")
+	}
+}
+
+func TestRunReturnsWhenReconcilerIgnoresCancellation(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	client := fake.NewSimpleClientset(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"}})
+	client.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{{Name: "pods", Namespaced: true, Kind: "Pod"}},
+	}}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	// Reconciler 不响应 ctx 的取消，两次等待都会超时
+	c, err := NewController(newTestClusterSet(client), record.NewFakeRecorder(10), reconcilerFunc(func(context.Context, string) (Result, error) {
+		close(started)
+		<-release
+		return Result{}, nil
+	}), ControllerOptions{
+		MaxRetries:      5,
+		ShutdownTimeout: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewController() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx, 1) }()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconcile was not started")
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() error = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after the shutdown timeouts")
+	}
+	// Reconciler 最终返回后，worker 和等待它的 goroutine 都应退出
+	close(release)
+}
+
+func TestIsTerminalError(t *testing.T) {
+	base := errors.New("boom")
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "plain error", err: base, want: false},
+		{name: "terminal", err: TerminalError(base), want: true},
+		{name: "wrapped terminal", err: fmt.Errorf("reconcile: %w", TerminalError(base)), want: true},
+		{name: "transient", err: TransientError(base), want: false},
+		{name: "transient overrides terminal", err: TransientError(TerminalError(base)), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTerminalError(tt.err); got != tt.want {
+				t.Errorf("IsTerminalError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// Dependency 描述被监听的对象（A）对另一种资源（B）的依赖：B 变化时，依赖它的 A 会被重新入队。
+// 控制器在 A 的 informer 上注册一个名为 Name 的索引，B 发生变化时通过该索引查找依赖它的 A。
+type Dependency struct {
+	// Name 为索引名称，在同一个 Reconciler 的依赖中必须唯一
+	Name string
+	// Informer 返回 B 的 informer。B 与 A 使用同一个 factory，因此监听的命名空间和标签、字段选择器也相同
+	Informer func(factory informers.SharedInformerFactory) cache.SharedIndexInformer
+	// Index 返回 A 所依赖的 B 的 namespace/name 形式的 key
+	Index cache.IndexFunc
+}
+
+// DependencyProvider 可以由 Reconciler 实现，声明被监听资源所依赖的资源，不支持通过 dynamic client 监听的资源。
+// 被依赖资源的 list/watch 权限需要包含在 RequiredPermissions 中。
+type DependencyProvider interface {
+	Dependencies() []Dependency
+}
+
+// MapFunc 将一个对象映射为需要重新入队的对象
+type MapFunc func(obj interface{}) []interface{}
+
+// EnqueueRequestsFromMapFunc 函数返回一个事件处理函数，对象新增、更新和删除时调用 mapFn 并通过 enqueue 将返回的对象入队。
+// 删除事件中的 DeletedFinalStateUnknown 会先被解开；更新事件同时映射新旧对象，使依赖关系的变化两边都能被处理。
+func EnqueueRequestsFromMapFunc(enqueue func(obj interface{}), mapFn MapFunc) cache.ResourceEventHandler {
+	handle := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		for _, mapped := range mapFn(obj) {
+			enqueue(mapped)
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: handle,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			handle(oldObj)
+			handle(newObj)
+		},
+		DeleteFunc: handle,
+	}
+}
+
+// dependentsOf 函数返回一个 MapFunc，通过 indexer 中名为 indexName 的索引查找依赖对象 B 的所有对象
+func dependentsOf(indexer cache.Indexer, indexName string) MapFunc {
+	return func(obj interface{}) []interface{} {
+		key, err := cache.MetaNamespaceKeyFunc(obj)
+		if err != nil {
+			klog.Errorf("计算依赖对象 key 失败: %v", err)
+			return nil
+		}
+		dependents, err := indexer.ByIndex(indexName, key)
+		if err != nil {
+			klog.ErrorS(err, "failed to look up dependents", "index", indexName, "dependency", key)
+			return nil
+		}
+		if len(dependents) > 0 {
+			logV(componentInformer, 4).InfoS("dependency changed, requeuing dependents", "index", indexName, "dependency", key, "dependents", len(dependents))
+		}
+		return dependents
+	}
+}
+
+// watchDependencies 函数在 informer 上为每个依赖注册索引，并从 factory 获取被依赖资源的 informer，
+// 被依赖的对象变化时通过 enqueue 将依赖它的对象入队。必须在 factory 启动之前调用。
+func watchDependencies(factory informers.SharedInformerFactory, informer cache.SharedIndexInformer, deps []Dependency, enqueue func(obj interface{})) error {
+	indexers := make(cache.Indexers, len(deps))
+	for _, dep := range deps {
+		indexers[dep.Name] = dep.Index
+	}
+	if err := informer.AddIndexers(indexers); err != nil {
+		return fmt.Errorf("注册依赖索引失败: %w", err)
+	}
+	for _, dep := range deps {
+		handler := EnqueueRequestsFromMapFunc(enqueue, dependentsOf(informer.GetIndexer(), dep.Name))
+		if _, err := dep.Informer(factory).AddEventHandler(handler); err != nil {
+			return fmt.Errorf("注册依赖 %s 的事件处理函数失败: %w", dep.Name, err)
+		}
+	}
+	return nil
+}
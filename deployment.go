@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// desiredReplicasAnnotation 是 DeploymentScaleReconciler 读取期望副本数的注解
+const desiredReplicasAnnotation = "first-controller.io/desired-replicas"
+
+// scaleRecordSuffix 是记录最近一次扩缩容的 ConfigMap 名称后缀
+const scaleRecordSuffix = "-scale"
+
+// managedByLabel 标记由本控制器创建的子对象，用于在全量同步时查找孤儿对象
+const managedByLabel = "app.kubernetes.io/managed-by"
+
+// DeploymentScaleReconciler 监听 Deployment，当 Deployment 带有 first-controller.io/desired-replicas 注解时，
+// 将 spec.replicas 修改为注解中的值。没有该注解的 Deployment 会被跳过。
+// 每次扩缩容后会在 <name>-scale ConfigMap 中记录调整前后的副本数，该 ConfigMap 属于对应的 Deployment，随 Deployment 一起被垃圾回收。
+type DeploymentScaleReconciler struct {
+	clusters *clusterSet
+	// cache 为控制器的 informer 缓存，为 nil 时直接从 API Server 读取
+	cache ObjectCache
+	// dryRun 为 true 时只记录将要执行的 patch 而不实际执行
+	dryRun bool
+}
+
+// NewDeploymentScaleReconciler 函数创建一个 DeploymentScaleReconciler
+func NewDeploymentScaleReconciler(clusters *clusterSet, dryRun bool) *DeploymentScaleReconciler {
+	return &DeploymentScaleReconciler{clusters: clusters, dryRun: dryRun}
+}
+
+// Informer 返回 Deployment 的 informer，使控制器监听 Deployment
+func (r *DeploymentScaleReconciler) Informer(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+	return factory.Apps().V1().Deployments().Informer()
+}
+
+// InjectCache 设置读取 Deployment 使用的 informer 缓存
+func (r *DeploymentScaleReconciler) InjectCache(cache ObjectCache) {
+	r.cache = cache
+}
+
+// Resource 返回 Deployment 的 GroupVersionResource
+func (r *DeploymentScaleReconciler) Resource() schema.GroupVersionResource {
+	return appsv1.SchemeGroupVersion.WithResource("deployments")
+}
+
+// RequiredPermissions 返回 DeploymentScaleReconciler 需要的权限
+func (r *DeploymentScaleReconciler) RequiredPermissions(namespace string) []authorizationv1.ResourceAttributes {
+	return append(resourcePermissions(namespace, "apps", "deployments", "get", "list", "watch", "patch"),
+		resourcePermissions(namespace, "", "configmaps", "get", "list", "create", "update", "delete")...)
+}
+
+// Reconcile 将 key 对应 Deployment 的副本数调整为注解中的期望值
+func (r *DeploymentScaleReconciler) Reconcile(ctx context.Context, key string) (Result, error) {
+	return Result{}, r.reconcile(ctx, key)
+}
+
+// reconcile 函数执行 Reconcile 的实际逻辑，扩缩容只需要执行一次，因此从不要求重新入队
+func (r *DeploymentScaleReconciler) reconcile(ctx context.Context, key string) error {
+	cluster, objectKey := splitClusterKey(key)
+	namespace, name, err := cache.SplitMetaNamespaceKey(objectKey)
+	if err != nil {
+		return err
+	}
+
+	deployments := r.clusters.Client(cluster).AppsV1().Deployments(namespace)
+	deploy, err := cachedGet(ctx, r.cache, cluster, namespace, func(factory informers.SharedInformerFactory) (*appsv1.Deployment, error) {
+		return factory.Apps().V1().Deployments().Lister().Deployments(namespace).Get(name)
+	}, func(ctx context.Context) (*appsv1.Deployment, error) {
+		return deployments.Get(ctx, name, metav1.GetOptions{})
+	})
+	if apierrors.IsNotFound(err) {
+		// Deployment 已被删除，无需处理
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	value, ok := deploy.Annotations[desiredReplicasAnnotation]
+	if !ok {
+		return nil
+	}
+	desired, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || desired < 0 {
+		// 注解的值不合法时重试也无法成功，等待注解被修改
+		return TerminalError(fmt.Errorf("注解 %s 的值 %q 不是合法的副本数", desiredReplicasAnnotation, value))
+	}
+	if deploy.Spec.Replicas != nil && int64(*deploy.Spec.Replicas) == desired {
+		return nil
+	}
+
+	klog.InfoS("scaling deployment", "key", key, "replicas", desired)
+	patch := []byte(fmt.Sprintf(`{"spec":{"replicas":%d}}`, desired))
+	err = guardedWrite(r.dryRun, "patch deployment replicas", key, deploy, func() (runtime.Object, error) {
+		return deployments.Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	})
+	if err != nil {
+		return err
+	}
+
+	previous := int32(1) // spec.replicas 未设置时默认为 1
+	if deploy.Spec.Replicas != nil {
+		previous = *deploy.Spec.Replicas
+	}
+	return r.recordScale(ctx, key, cluster, deploy, previous, int32(desired))
+}
+
+// recordScale 函数创建或更新 deploy 对应的 <name>-scale ConfigMap，记录调整前后的副本数
+func (r *DeploymentScaleReconciler) recordScale(ctx context.Context, key, cluster string, deploy *appsv1.Deployment, previous, desired int32) error {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploy.Name + scaleRecordSuffix,
+			Namespace: deploy.Namespace,
+			Labels:    map[string]string{managedByLabel: controllerName},
+		},
+		Data: map[string]string{
+			"previousReplicas": strconv.Itoa(int(previous)),
+			"desiredReplicas":  strconv.Itoa(int(desired)),
+		},
+	}
+	setOwnerReference(cm, deploy, appsv1.SchemeGroupVersion.WithKind("Deployment"))
+
+	configMaps := r.clusters.Client(cluster).CoreV1().ConfigMaps(deploy.Namespace)
+	err := guardedWrite(r.dryRun, "create deployment scale record", key, nil, func() (runtime.Object, error) {
+		return configMaps.Create(ctx, cm, metav1.CreateOptions{})
+	})
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	existing, err := configMaps.Get(ctx, cm.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	before := existing.DeepCopy()
+	existing.Data = cm.Data
+	if existing.Labels == nil {
+		existing.Labels = map[string]string{}
+	}
+	existing.Labels[managedByLabel] = controllerName
+	setOwnerReference(existing, deploy, appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	return guardedWrite(r.dryRun, "update deployment scale record", key, before, func() (runtime.Object, error) {
+		return configMaps.Update(ctx, existing, metav1.UpdateOptions{})
+	})
+}
+
+// CollectOrphans 删除 namespace 中 Deployment 已经不存在的扩缩容记录 ConfigMap。
+// 正常情况下这些 ConfigMap 会被垃圾回收，但以 orphan 方式删除 Deployment 时会被遗留下来。
+func (r *DeploymentScaleReconciler) CollectOrphans(ctx context.Context, cluster, namespace string) error {
+	client := r.clusters.Client(cluster)
+	configMaps, err := client.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: managedByLabel + "=" + controllerName,
+	})
+	if err != nil {
+		return err
+	}
+	for i := range configMaps.Items {
+		cm := &configMaps.Items[i]
+		owner := metav1.GetControllerOf(cm)
+		if owner == nil || owner.Kind != "Deployment" {
+			continue
+		}
+		deploy, err := client.AppsV1().Deployments(cm.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err == nil && deploy.UID == owner.UID {
+			continue
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		key := cm.Namespace + "/" + cm.Name
+		klog.InfoS("deleting orphaned scale record", "cluster", cluster, "configmap", key, "deployment", owner.Name)
+		err = guardedWrite(r.dryRun, "delete orphaned scale record", key, cm, func() (runtime.Object, error) {
+			err := client.CoreV1().ConfigMaps(cm.Namespace).Delete(ctx, cm.Name, metav1.DeleteOptions{
+				Preconditions: &metav1.Preconditions{UID: &cm.UID},
+			})
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newTestDeployment(replicas int32, annotations map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "default",
+			UID:         "web-uid",
+			Annotations: annotations,
+		},
+		Spec: appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+}
+
+// patchActions 函数返回 client 记录的所有 patch 请求
+func patchActions(client *fake.Clientset) []k8stesting.PatchAction {
+	var patches []k8stesting.PatchAction
+	for _, action := range client.Actions() {
+		if patch, ok := action.(k8stesting.PatchAction); ok {
+			patches = append(patches, patch)
+		}
+	}
+	return patches
+}
+
+func TestDeploymentScaleReconciler(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		dryRun      bool
+		wantPatch   string
+		wantErr     bool
+	}{
+		{
+			name:        "patches replicas from annotation",
+			annotations: map[string]string{desiredReplicasAnnotation: "3"},
+			wantPatch:   `{"spec":{"replicas":3}}`,
+		},
+		{
+			name: "skips deployment without annotation",
+		},
+		{
+			name:        "skips deployment already at desired replicas",
+			annotations: map[string]string{desiredReplicasAnnotation: "1"},
+		},
+		{
+			name:        "dry-run does not patch",
+			annotations: map[string]string{desiredReplicasAnnotation: "3"},
+			dryRun:      true,
+		},
+		{
+			name:        "invalid annotation",
+			annotations: map[string]string{desiredReplicasAnnotation: "three"},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(newTestDeployment(1, tt.annotations))
+			r := NewDeploymentScaleReconciler(newTestClusterSet(client), tt.dryRun)
+
+			_, err := r.Reconcile(context.Background(), "default/web")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reconcile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			patches := patchActions(client)
+			if tt.wantPatch == "" {
+				if len(patches) != 0 {
+					t.Fatalf("got %d patch actions, want none", len(patches))
+				}
+				return
+			}
+			if len(patches) != 1 {
+				t.Fatalf("got %d patch actions, want 1", len(patches))
+			}
+			if patches[0].GetPatchType() != types.StrategicMergePatchType {
+				t.Errorf("patch type = %s, want %s", patches[0].GetPatchType(), types.StrategicMergePatchType)
+			}
+			if got := string(patches[0].GetPatch()); got != tt.wantPatch {
+				t.Errorf("patch = %s, want %s", got, tt.wantPatch)
+			}
+		})
+	}
+}
+
+func TestDeploymentScaleReconcilerIgnoresMissingDeployment(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	r := NewDeploymentScaleReconciler(newTestClusterSet(client), false)
+
+	if _, err := r.Reconcile(context.Background(), "default/missing"); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+}
+
+func TestDeploymentScaleReconcilerRecordsScaleOwnedByDeployment(t *testing.T) {
+	client := fake.NewSimpleClientset(newTestDeployment(1, map[string]string{desiredReplicasAnnotation: "3"}))
+	r := NewDeploymentScaleReconciler(newTestClusterSet(client), false)
+
+	if _, err := r.Reconcile(context.Background(), "default/web"); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	cm, err := client.CoreV1().ConfigMaps("default").Get(context.Background(), "web"+scaleRecordSuffix, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get scale record: %v", err)
+	}
+	if cm.Data["previousReplicas"] != "1" || cm.Data["desiredReplicas"] != "3" {
+		t.Errorf("scale record data = %v, want previousReplicas=1 desiredReplicas=3", cm.Data)
+	}
+	refs := cm.GetOwnerReferences()
+	if len(refs) != 1 {
+		t.Fatalf("got %d owner references, want 1", len(refs))
+	}
+	if refs[0].Kind != "Deployment" || refs[0].Name != "web" || refs[0].UID != "web-uid" {
+		t.Errorf("owner reference = %+v, want Deployment web (web-uid)", refs[0])
+	}
+	if refs[0].Controller == nil || !*refs[0].Controller {
+		t.Error("owner reference Controller is not true")
+	}
+
+	// 扩缩容记录已存在时更新而不是报错
+	if _, err := client.AppsV1().Deployments("default").Update(context.Background(), newTestDeployment(2, map[string]string{desiredReplicasAnnotation: "5"}), metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update deployment: %v", err)
+	}
+	if _, err := r.Reconcile(context.Background(), "default/web"); err != nil {
+		t.Fatalf("second Reconcile() error = %v", err)
+	}
+	cm, err = client.CoreV1().ConfigMaps("default").Get(context.Background(), "web"+scaleRecordSuffix, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get scale record: %v", err)
+	}
+	if cm.Data["previousReplicas"] != "2" || cm.Data["desiredReplicas"] != "5" {
+		t.Errorf("scale record data = %v, want previousReplicas=2 desiredReplicas=5", cm.Data)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog/v2"
+)
+
+// parseGVR 函数解析 group/version/resource 形式的资源，例如 apps/v1/deployments 或 example.com/v1/widgets；
+// 核心组的资源写成 version/resource，例如 v1/pods。
+func parseGVR(s string) (schema.GroupVersionResource, error) {
+	parts := strings.Split(s, "/")
+	for _, part := range parts {
+		if part == "" {
+			return schema.GroupVersionResource{}, fmt.Errorf("资源 %q 格式错误，应为 group/version/resource 或 version/resource", s)
+		}
+	}
+	switch len(parts) {
+	case 2:
+		return schema.GroupVersionResource{Version: parts[0], Resource: parts[1]}, nil
+	case 3:
+		return schema.GroupVersionResource{Group: parts[0], Version: parts[1], Resource: parts[2]}, nil
+	default:
+		return schema.GroupVersionResource{}, fmt.Errorf("资源 %q 格式错误，应为 group/version/resource 或 version/resource", s)
+	}
+}
+
+// resourceServed 函数通过 discovery 检查 API Server 是否提供 gvr 资源。资源不存在（例如 CRD 尚未安装）时返回 false 和 nil。
+func resourceServed(client discovery.DiscoveryInterface, gvr schema.GroupVersionResource) (bool, error) {
+	resources, err := client.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == gvr.Resource {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// waitForResource 函数在启动 informer 之前确认 gvr 资源已经可用，避免 CRD 未安装时 informer 不断报错。
+// require 为 true 时资源不存在立即返回错误；否则按指数退避等待资源出现，直到 ctx 取消。
+func waitForResource(ctx context.Context, cluster string, client discovery.DiscoveryInterface, gvr schema.GroupVersionResource, require bool) error {
+	backoff := wait.Backoff{
+		Duration: time.Second,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    math.MaxInt32,
+		Cap:      time.Minute,
+	}
+	return wait.ExponentialBackoffWithContext(ctx, backoff, func(context.Context) (bool, error) {
+		served, err := resourceServed(client, gvr)
+		if err != nil {
+			klog.ErrorS(err, "failed to discover resource, retrying", "cluster", cluster, "resource", gvr.String())
+			return false, nil
+		}
+		if served {
+			return true, nil
+		}
+		if require {
+			return false, fmt.Errorf("集群中不存在资源 %s，对应的 CRD 可能尚未安装", gvr.String())
+		}
+		klog.InfoS("CRD not yet installed, waiting", "cluster", cluster, "resource", gvr.String())
+		return false, nil
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+const (
+	// controllerName 是事件来源中的组件名称
+	controllerName = "first-controller"
+
+	eventReasonBecameLeader        = "BecameLeader"
+	eventReasonLostLeadership      = "LostLeadership"
+	eventReasonPreempted           = "Preempted"
+	eventReasonReconcileFailed     = "ReconcileFailed"
+	eventReasonLockAnomaly         = "LockAnomaly"
+	eventReasonWriteAccessLost     = "WriteAccessLost"
+	eventReasonWriteAccessRestored = "WriteAccessRestored"
+	eventReasonLeaseRetained       = "LeaseRetained"
+	eventReasonManualStepdown      = "ManualStepdown"
+)
+
+// discardRecorder 丢弃所有事件，用于没有可以记录事件的对象时（例如不在 Pod 中运行的 Redis 锁）
+type discardRecorder struct{}
+
+func (discardRecorder) Event(object runtime.Object, eventtype, reason, message string) {}
+
+func (discardRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+}
+
+func (discardRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+}
+
+// newEventRecorder 函数创建一个 EventRecorder，事件写入所涉及对象所在的命名空间，调用方负责在退出时关闭返回的 EventBroadcaster。
+// dedupWindow 大于 0 时，同一对象上 reason 相同的事件在 dedupWindow 内合并为一个事件并累加计数，消息为最近一次的内容。
+func newEventRecorder(events typedcorev1.EventsGetter, dedupWindow time.Duration) (record.EventRecorder, record.EventBroadcaster) {
+	var opts []record.BroadcasterOption
+	if dedupWindow > 0 {
+		opts = append(opts, record.WithCorrelatorOptions(dedupCorrelatorOptions(dedupWindow, clock.RealClock{})))
+	}
+	broadcaster := record.NewBroadcaster(opts...)
+	broadcaster.StartStructuredLogging(4)
+	broadcaster.StartRecordingToSink(eventSink{events: events})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerName})
+	klog.V(4).InfoS("event recorder started")
+	return recorder, broadcaster
+}
+
+// eventSink 与 typedcorev1.EventSinkImpl 相同，但每次写入时才通过 events 获取 EventInterface，
+// events 为 homeClient 时重新加载 kubeconfig 后事件随之使用新的凭据。
+// 固定命名空间的 EventInterface 会拒绝其他命名空间中的事件，因此使用 NamespaceAll 才能记录被监听对象、锁对象和 Pod 上的事件。
+type eventSink struct {
+	events typedcorev1.EventsGetter
+}
+
+func (s eventSink) Create(event *corev1.Event) (*corev1.Event, error) {
+	return s.events.Events(metav1.NamespaceAll).CreateWithEventNamespace(event)
+}
+
+func (s eventSink) Update(event *corev1.Event) (*corev1.Event, error) {
+	return s.events.Events(metav1.NamespaceAll).UpdateWithEventNamespace(event)
+}
+
+func (s eventSink) Patch(event *corev1.Event, data []byte) (*corev1.Event, error) {
+	return s.events.Events(metav1.NamespaceAll).PatchWithEventNamespace(event, data)
+}
+
+// dedupCorrelatorOptions 函数返回按 (对象, reason) 合并事件的 CorrelatorOptions：窗口内的事件合并为同一个 Event 并累加计数，
+// 保留最近一次的消息而不添加 "(combined from similar events)" 前缀；窗口过期后的事件创建新的 Event。
+// client-go 的 MaxIntervalInSeconds 只会重置聚合记录，聚合后的 Event 仍会被无限期地更新，因此窗口由 eventDeduper 编码进聚合 key。
+func dedupCorrelatorOptions(window time.Duration, clk clock.PassiveClock) record.CorrelatorOptions {
+	deduper := &eventDeduper{window: window, clock: clk, windows: make(map[string]time.Time)}
+	return record.CorrelatorOptions{
+		KeyFunc:   deduper.key,
+		MaxEvents: 1,
+		MessageFunc: func(event *corev1.Event) string {
+			return event.Message
+		},
+		Clock: clk,
+	}
+}
+
+// eventDeduper 记录每组 (对象, reason) 事件当前窗口的开始时间，组内的第一个事件在没有窗口或窗口已经过期时开启新的窗口
+type eventDeduper struct {
+	window time.Duration
+	clock  clock.PassiveClock
+
+	mu      sync.Mutex
+	windows map[string]time.Time
+}
+
+// key 实现 record.EventAggregatorKeyFunc，在 client-go 按 reason 聚合的 key 后追加当前窗口的开始时间，
+// 使同一窗口内的事件对应同一个 Event，而下一个窗口的事件对应新的 Event。
+func (d *eventDeduper) key(event *corev1.Event) (string, string) {
+	aggregateKey, localKey := record.EventAggregatorByReasonFunc(event)
+	now := d.clock.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	start, ok := d.windows[aggregateKey]
+	if !ok || now.Sub(start) >= d.window {
+		// 开启新窗口时顺便清理已经过期的窗口，避免不再产生事件的对象一直占用内存
+		for k, s := range d.windows {
+			if now.Sub(s) >= d.window {
+				delete(d.windows, k)
+			}
+		}
+		start = now
+		d.windows[aggregateKey] = start
+	}
+	return aggregateKey + "/" + strconv.FormatInt(start.UnixNano(), 10), localKey
+}
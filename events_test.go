@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestEventRecorderWritesToObjectNamespace(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	recorder, broadcaster := newEventRecorder(client.CoreV1(), 0)
+	defer broadcaster.Shutdown()
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps", UID: "uid-web"}}
+	recorder.Eventf(pod, corev1.EventTypeWarning, eventReasonReconcileFailed, "reconcile failed: %v", "boom")
+
+	events := waitForEvents(t, client, "apps", 1)
+	if events[0].InvolvedObject.Name != "web" || events[0].Reason != eventReasonReconcileFailed {
+		t.Errorf("event = %+v, want ReconcileFailed on apps/web", events[0])
+	}
+}
+
+func TestEventRecorderWritesRedisLockEventsToPodNamespace(t *testing.T) {
+	t.Setenv("POD_NAMESPACE", "controllers")
+	t.Setenv("POD_NAME", "first-controller-0")
+	client := fake.NewSimpleClientset()
+	recorder, broadcaster := newEventRecorder(client.CoreV1(), 0)
+	defer broadcaster.Shutdown()
+
+	lockRef := lockObjectReference(lockTypeRedis, "first-controller", "kube-system")
+	if lockRef == nil {
+		t.Fatal("lockObjectReference() = nil")
+	}
+	recorder.Eventf(lockRef, corev1.EventTypeNormal, eventReasonBecameLeader, "%s became leader", "first-controller-0")
+
+	events := waitForEvents(t, client, "controllers", 1)
+	if events[0].InvolvedObject.Kind != "Pod" || events[0].InvolvedObject.Name != "first-controller-0" {
+		t.Errorf("event involved object = %+v, want Pod controllers/first-controller-0", events[0].InvolvedObject)
+	}
+}
+
+// waitForEvents 函数等待 namespace 中出现 want 个事件并返回这些事件
+func waitForEvents(t *testing.T, client *fake.Clientset, namespace string, want int) []corev1.Event {
+	t.Helper()
+	var events []corev1.Event
+	err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		list, err := client.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return false, err
+		}
+		events = list.Items
+		return len(events) >= want, nil
+	})
+	if err != nil {
+		t.Fatalf("waiting for %d events in %s: got %d: %v", want, namespace, len(events), err)
+	}
+	return events
+}
+
+func TestDedupCorrelatorMergesWithinWindow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := clocktesting.NewFakeClock(start)
+	correlator := record.NewEventCorrelatorWithOptions(dedupCorrelatorOptions(time.Minute, clock))
+
+	newEvent := func(reason, message string) *corev1.Event {
+		now := metav1.NewTime(clock.Now())
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "web." + message, Namespace: "apps"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "apps", Name: "web", UID: "uid-web"},
+			Reason:         reason,
+			Message:        message,
+			Type:           corev1.EventTypeWarning,
+			Source:         corev1.EventSource{Component: controllerName},
+			Count:          1,
+			FirstTimestamp: now,
+			LastTimestamp:  now,
+		}
+	}
+	correlate := func(event *corev1.Event) *record.EventCorrelateResult {
+		t.Helper()
+		result, err := correlator.EventCorrelate(event)
+		if err != nil {
+			t.Fatalf("EventCorrelate() error = %v", err)
+		}
+		if result.Skip {
+			t.Fatalf("EventCorrelate() skipped %q", event.Message)
+		}
+		return result
+	}
+
+	first := correlate(newEvent(eventReasonReconcileFailed, "first"))
+	if first.Patch != nil {
+		t.Fatalf("first event was patched, want a new Event")
+	}
+
+	// 窗口内 reason 相同的事件合并到第一个 Event 上，消息为最近一次的内容
+	clock.Step(30 * time.Second)
+	second := correlate(newEvent(eventReasonReconcileFailed, "second"))
+	if second.Patch == nil || second.Event.Name != first.Event.Name {
+		t.Fatalf("event within window created %q, want a patch of %q", second.Event.Name, first.Event.Name)
+	}
+	if second.Event.Count != 2 || second.Event.Message != "second" {
+		t.Errorf("merged event count = %d, message = %q, want 2, %q", second.Event.Count, second.Event.Message, "second")
+	}
+
+	// reason 不同的事件不合并
+	other := correlate(newEvent(eventReasonLockAnomaly, "other"))
+	if other.Patch != nil {
+		t.Errorf("event with a different reason patched %q, want a new Event", other.Event.Name)
+	}
+
+	// 窗口过期后创建新的 Event，计数重新开始
+	clock.Step(31 * time.Second)
+	third := correlate(newEvent(eventReasonReconcileFailed, "third"))
+	if third.Patch != nil || third.Event.Name == first.Event.Name {
+		t.Fatalf("event after window patched %q, want a new Event", third.Event.Name)
+	}
+	if third.Event.Count != 1 {
+		t.Errorf("new event count = %d, want 1", third.Event.Count)
+	}
+	fourth := correlate(newEvent(eventReasonReconcileFailed, "fourth"))
+	if fourth.Patch == nil || fourth.Event.Name != third.Event.Name {
+		t.Errorf("event in the new window created %q, want a patch of %q", fourth.Event.Name, third.Event.Name)
+	}
+}
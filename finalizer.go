@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// controllerFinalizer 是控制器添加到父对象上的 finalizer，保证父对象删除前先清理其子对象
+const controllerFinalizer = "first-controller.io/finalizer"
+
+// patchFunc 以 JSON merge patch 的方式修改对象，由调用方绑定具体资源的客户端
+type patchFunc func(ctx context.Context, data []byte) error
+
+// hasFinalizer 返回 obj 是否带有名为 name 的 finalizer
+func hasFinalizer(obj metav1.Object, name string) bool {
+	for _, f := range obj.GetFinalizers() {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// finalizersPatch 函数生成将 finalizers 修改为指定列表的 merge patch，
+// 其中带上 resourceVersion，在对象已被修改时请求会因冲突而失败，避免覆盖其他组件添加的 finalizer。
+func finalizersPatch(obj metav1.Object, finalizers []string) ([]byte, error) {
+	if finalizers == nil {
+		finalizers = []string{}
+	}
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      finalizers,
+			"resourceVersion": obj.GetResourceVersion(),
+		},
+	})
+}
+
+// ensureFinalizer 函数在 obj 上添加名为 name 的 finalizer，已经存在时不做任何操作。
+// 正在删除的对象不能再添加 finalizer，否则会阻塞删除，此时同样不做任何操作。返回是否发起了修改。
+func ensureFinalizer(ctx context.Context, obj metav1.Object, name string, patch patchFunc) (bool, error) {
+	if obj.GetDeletionTimestamp() != nil || hasFinalizer(obj, name) {
+		return false, nil
+	}
+	data, err := finalizersPatch(obj, append(obj.GetFinalizers(), name))
+	if err != nil {
+		return false, err
+	}
+	return true, patch(ctx, data)
+}
+
+// removeFinalizer 函数从 obj 上移除名为 name 的 finalizer，不存在时不做任何操作。
+func removeFinalizer(ctx context.Context, obj metav1.Object, name string, patch patchFunc) error {
+	if !hasFinalizer(obj, name) {
+		return nil
+	}
+	finalizers := make([]string, 0, len(obj.GetFinalizers()))
+	for _, f := range obj.GetFinalizers() {
+		if f != name {
+			finalizers = append(finalizers, f)
+		}
+	}
+	data, err := finalizersPatch(obj, finalizers)
+	if err != nil {
+		return err
+	}
+	return patch(ctx, data)
+}
+
+// handleFinalizer 函数实现标准的 finalizer 流程：对象未被删除时确保带有 finalizer；
+// 对象正在删除时先调用 cleanup 清理子对象，成功后再移除 finalizer。
+// 返回 deleting 为 true 表示对象正在删除，调用方不应再继续后续的 reconcile 逻辑。
+func handleFinalizer(ctx context.Context, obj metav1.Object, name string, patch patchFunc, cleanup func(ctx context.Context) error) (deleting bool, err error) {
+	if obj.GetDeletionTimestamp() == nil {
+		_, err := ensureFinalizer(ctx, obj, name, patch)
+		return false, err
+	}
+
+	if !hasFinalizer(obj, name) {
+		return true, nil
+	}
+	if err := cleanup(ctx); err != nil {
+		return true, err
+	}
+	return true, removeFinalizer(ctx, obj, name, patch)
+}
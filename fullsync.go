@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// fullSyncPageSize 为全量同步时每页获取的对象数量
+const fullSyncPageSize = 500
+
+// partialObjectMetadataList 让 API Server 只返回对象的元数据，降低全量同步的开销
+const partialObjectMetadataList = "application/json;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1"
+
+// OrphanCollector 可以由 Reconciler 实现，在全量同步时清理 namespace 中父对象已经不存在的子对象，namespace 为空表示所有命名空间。
+type OrphanCollector interface {
+	CollectOrphans(ctx context.Context, cluster, namespace string) error
+}
+
+// runFullSync 函数每隔 period 执行一次全量同步，直到 ctx 取消。
+func (c *Controller) runFullSync(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.fullSync(ctx)
+		}
+	}
+}
+
+// fullSync 函数从 API Server 列出所有被监听的对象并与 informer 缓存比较：
+// API Server 中存在而缓存中没有的对象（丢失的新增事件）和缓存中存在而 API Server 中已经没有的对象（丢失的删除事件）都会重新入队。
+// resync 只会重放缓存中的对象，无法发现 watch 重连期间丢失的删除事件，因此需要定期全量同步。
+func (c *Controller) fullSync(ctx context.Context) {
+	start := time.Now()
+	enqueued := 0
+	collector, collect := c.reconciler.(OrphanCollector)
+	for _, cluster := range c.clusters.names {
+		client := c.clusters.Client(cluster)
+		for namespace, informer := range c.informers[cluster].informers() {
+			n, err := c.fullSyncInformer(ctx, cluster, client, namespace, informer)
+			if err != nil {
+				klog.ErrorS(err, "full sync failed", "cluster", cluster, "namespace", namespace)
+			}
+			enqueued += n
+
+			if collect {
+				if err := collector.CollectOrphans(ctx, cluster, namespace); err != nil {
+					klog.ErrorS(err, "failed to collect orphaned objects", "cluster", cluster, "namespace", namespace)
+				}
+			}
+		}
+	}
+	klog.InfoS("full sync finished", "enqueued", enqueued, "duration", time.Since(start))
+}
+
+// fullSyncInformer 函数对一个 informer 执行全量同步，返回重新入队的对象数量
+func (c *Controller) fullSyncInformer(ctx context.Context, cluster string, client clientset.Interface, namespace string, informer cache.SharedIndexInformer) (int, error) {
+	objects, err := listObjectMetadata(ctx, client, c.resource, namespace, c.informerOpts)
+	if err != nil {
+		return 0, err
+	}
+
+	store := informer.GetStore()
+	live := sets.New[string]()
+	enqueued := 0
+	for i := range objects {
+		obj := &objects[i]
+		key := cache.NewObjectName(obj.Namespace, obj.Name).String()
+		live.Insert(key)
+		if _, exists, _ := store.GetByKey(key); !exists {
+			logV(componentInformer, 2).InfoS("full sync found object missing from cache", "cluster", cluster, "key", key)
+			c.enqueue(cluster, obj)
+			enqueued++
+		}
+	}
+	for _, key := range store.ListKeys() {
+		if live.Has(key) {
+			continue
+		}
+		obj, exists, _ := store.GetByKey(key)
+		if !exists {
+			continue
+		}
+		logV(componentInformer, 2).InfoS("full sync found deleted object still in cache", "cluster", cluster, "key", key)
+		c.enqueue(cluster, cache.DeletedFinalStateUnknown{Key: key, Obj: obj})
+		enqueued++
+	}
+	return enqueued, nil
+}
+
+// listObjectMetadata 函数分页列出 namespace 中 gvr 资源的所有对象，只获取元数据。namespace 为空时列出所有命名空间。
+func listObjectMetadata(ctx context.Context, client clientset.Interface, gvr schema.GroupVersionResource, namespace string, opts informerOptions) ([]metav1.PartialObjectMetadata, error) {
+	restClient := client.Discovery().RESTClient()
+	if restClient == nil {
+		return nil, fmt.Errorf("客户端不支持通用的 list 请求")
+	}
+
+	// 核心组的资源位于 /api/v1，其他组位于 /apis/<group>/<version>
+	prefix := path.Join("/apis", gvr.Group, gvr.Version)
+	if gvr.Group == "" {
+		prefix = path.Join("/api", gvr.Version)
+	}
+	resourcePath := path.Join(prefix, gvr.Resource)
+	if namespace != metav1.NamespaceAll {
+		resourcePath = path.Join(prefix, "namespaces", namespace, gvr.Resource)
+	}
+
+	var objects []metav1.PartialObjectMetadata
+	continueToken := ""
+	for {
+		req := restClient.Get().AbsPath(resourcePath).
+			SetHeader("Accept", partialObjectMetadataList).
+			Param("limit", fmt.Sprint(fullSyncPageSize))
+		if continueToken != "" {
+			req = req.Param("continue", continueToken)
+		}
+		if opts.labelSelector != nil {
+			req = req.Param("labelSelector", opts.labelSelector.String())
+		}
+		if opts.fieldSelector != nil {
+			req = req.Param("fieldSelector", opts.fieldSelector.String())
+		}
+		body, err := req.Do(ctx).Raw()
+		if err != nil {
+			return nil, fmt.Errorf("列出 %s 失败: %w", gvr.String(), err)
+		}
+		var list metav1.PartialObjectMetadataList
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil, fmt.Errorf("解析 %s 列表失败: %w", gvr.String(), err)
+		}
+		objects = append(objects, list.Items...)
+		if list.Continue == "" {
+			return objects, nil
+		}
+		continueToken = list.Continue
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"k8s.io/klog/v2"
+)
+
+// startHealthServer 函数启动一个 HTTP 服务，提供 /healthz 存活探针和 /readyz 就绪探针，并在 ctx 取消时关闭服务。返回的 channel 在服务关闭完成后关闭。
+// /readyz 只有在 ready 返回 true 时才返回 200；/healthz 在 alive 返回错误时返回 500，使 kubelet 重启 Pod。
+func startHealthServer(ctx context.Context, addr string, ready func() bool, alive func(r *http.Request) error) <-chan struct{} {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := alive(r); err != nil {
+			klog.ErrorS(err, "liveness check failed")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if !ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	return serveHTTP(ctx, "health", addr, mux)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// listenNetwork 是所有 HTTP 服务监听时使用的网络类型：tcp 同时支持 IPv4 和 IPv6，tcp4 和 tcp6 只使用对应的地址族。
+// 由 setListenNetwork 设置。
+var listenNetwork = "tcp"
+
+// httpShutdownTimeout 是关闭 HTTP 服务时等待处理中的请求完成的最长时间，由 realMain 根据 --http-shutdown-timeout 设置
+var httpShutdownTimeout = 5 * time.Second
+
+// runningServer 是一个已经启动的 HTTP 服务，stop 开始优雅关闭，done 在关闭完成后关闭
+type runningServer struct {
+	stop context.CancelFunc
+	done <-chan struct{}
+}
+
+// startServer 函数使用一个独立的 context 调用 start 启动 HTTP 服务，使该服务可以按顺序单独关闭
+func startServer(start func(ctx context.Context) <-chan struct{}) runningServer {
+	ctx, stop := context.WithCancel(context.Background())
+	return runningServer{stop: stop, done: start(ctx)}
+}
+
+// shutdown 函数关闭服务并等待关闭完成
+func (s runningServer) shutdown() {
+	s.stop()
+	<-s.done
+}
+
+// setListenNetwork 函数检查 network 是否为 tcp、tcp4 或 tcp6，并确认节点上该地址族可用、addrs 中指定的 IP 属于该地址族，
+// 检查通过后将其设置为所有 HTTP 服务使用的网络类型。addrs 中的空地址会被忽略。
+func setListenNetwork(network string, addrs ...string) error {
+	var loopback string
+	switch network {
+	case "tcp":
+	case "tcp4":
+		loopback = "127.0.0.1:0"
+	case "tcp6":
+		loopback = "[::1]:0"
+	default:
+		return fmt.Errorf("未知的监听地址族 %q，可选值为 tcp、tcp4、tcp6", network)
+	}
+
+	for _, addr := range addrs {
+		if addr == "" {
+			continue
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("监听地址 %q 格式错误: %w", addr, err)
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			continue
+		}
+		if (network == "tcp4" && ip.To4() == nil) || (network == "tcp6" && ip.To4() != nil) {
+			return fmt.Errorf("监听地址 %q 不属于地址族 %s", addr, network)
+		}
+	}
+
+	if loopback != "" {
+		ln, err := net.Listen(network, loopback)
+		if err != nil {
+			return fmt.Errorf("当前节点不支持地址族 %s: %w", network, err)
+		}
+		ln.Close()
+	}
+	listenNetwork = network
+	return nil
+}
+
+// serveHTTP 函数在后台启动一个 HTTP 服务，并在 ctx 取消时关闭该服务。name 仅用于日志输出。
+// 返回的 channel 在服务关闭完成后关闭。
+func serveHTTP(ctx context.Context, name, addr string, handler http.Handler) <-chan struct{} {
+	srv := newHTTPServer(addr, handler)
+	return serve(ctx, name, srv, srv.Serve)
+}
+
+// serveHTTPS 函数与 serveHTTP 相同，但使用 certFile 和 keyFile 指定的证书提供 HTTPS 服务。
+func serveHTTPS(ctx context.Context, name, addr, certFile, keyFile string, handler http.Handler) <-chan struct{} {
+	srv := newHTTPServer(addr, handler)
+	return serve(ctx, name, srv, func(ln net.Listener) error {
+		return srv.ServeTLS(ln, certFile, keyFile)
+	})
+}
+
+// serveReloadingTLS 函数与 serveHTTPS 相同，但每次 TLS 握手前检查证书文件是否有更新，有更新时重新加载，
+// 证书轮换后无需重启。clientCAFile 不为空时要求客户端提供由该 CA 签发的证书（mTLS）。
+func serveReloadingTLS(ctx context.Context, name, addr, certFile, keyFile, clientCAFile string, handler http.Handler) (<-chan struct{}, error) {
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取客户端 CA 证书失败: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("客户端 CA 证书 %s 中没有合法的证书", clientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	srv := newHTTPServer(addr, handler)
+	srv.TLSConfig = tlsConfig
+	return serve(ctx, name, srv, func(ln net.Listener) error {
+		return srv.ServeTLS(ln, "", "")
+	}), nil
+}
+
+// certReloader 在证书或私钥文件的修改时间变化时重新加载证书，加载失败时继续使用原有的证书
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// newCertReloader 函数加载 certFile 和 keyFile 并创建 certReloader，首次加载失败时返回错误
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// latestModTime 函数返回证书和私钥文件中较新的修改时间
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("读取证书文件失败: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// load 函数加载证书并记录文件的修改时间，调用方需要持有 r.mu 或保证没有并发访问
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("加载证书 %s 失败: %w", r.certFile, err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// GetCertificate 实现 tls.Config.GetCertificate，文件有更新时重新加载证书
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	modTime, err := r.latestModTime()
+	if err == nil && !modTime.Equal(r.modTime) {
+		if err := r.load(modTime); err != nil {
+			klog.ErrorS(err, "failed to reload certificate, keeping the previous one", "cert", r.certFile)
+		} else {
+			klog.InfoS("reloaded certificate", "cert", r.certFile)
+		}
+	}
+	return r.cert, nil
+}
+
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
+
+// serve 函数在后台按 listenNetwork 监听 srv.Addr 并调用 listen 启动 srv，并在 ctx 取消时关闭 srv。
+// 关闭时不再接受新连接，并最多等待 httpShutdownTimeout 让处理中的请求完成，超时后强制关闭剩余的连接。
+func serve(ctx context.Context, name string, srv *http.Server, listen func(ln net.Listener) error) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		klog.InfoS("draining HTTP server", "server", name, "timeout", httpShutdownTimeout)
+		start := time.Now()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			klog.Errorf("关闭 %s 服务失败，强制关闭剩余的连接: %v", name, err)
+			_ = srv.Close()
+		}
+		klog.InfoS("HTTP server stopped", "server", name, "duration", time.Since(start))
+	}()
+
+	go func() {
+		ln, err := net.Listen(listenNetwork, srv.Addr)
+		if err != nil {
+			klog.Errorf("%s 服务监听 %s (%s) 失败: %v", name, srv.Addr, listenNetwork, err)
+			return
+		}
+		klog.Infof("%s server listening on %s (%s)", name, srv.Addr, listenNetwork)
+		if err := listen(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			klog.Errorf("%s 服务异常退出: %v", name, err)
+		}
+	}()
+	return done
+}
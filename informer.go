@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// informerFactory 是 SharedInformerFactory 和 DynamicSharedInformerFactory 的公共部分
+type informerFactory interface {
+	Start(stopCh <-chan struct{})
+	Shutdown()
+}
+
+// informerFactories 将多个 informerFactory 组合为一个，依次启动和关闭
+type informerFactories []informerFactory
+
+func (fs informerFactories) Start(stopCh <-chan struct{}) {
+	for _, f := range fs {
+		f.Start(stopCh)
+	}
+}
+
+func (fs informerFactories) Shutdown() {
+	for _, f := range fs {
+		f.Shutdown()
+	}
+}
+
+// sharedInformerFactory 函数返回 factory 中的 SharedInformerFactory，factory 为 dynamic informer 的 factory 时返回 false
+func sharedInformerFactory(factory informerFactory) (informers.SharedInformerFactory, bool) {
+	switch f := factory.(type) {
+	case informers.SharedInformerFactory:
+		return f, true
+	case informerFactories:
+		for _, inner := range f {
+			if shared, ok := sharedInformerFactory(inner); ok {
+				return shared, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// informerFunc 为 namespace（为空表示所有命名空间）创建 factory 并从中获取被监听资源的 informer
+type informerFunc func(namespace string) (informerFactory, cache.SharedIndexInformer, error)
+
+// scopedInformer 是某个命名空间（或所有命名空间）中被监听资源的 informer 及其所属的 factory
+type scopedInformer struct {
+	factory      informerFactory
+	informer     cache.SharedIndexInformer
+	registration cache.ResourceEventHandlerRegistration
+	cancel       context.CancelFunc
+	// synced 表示 informer 已经完成初始同步，由 clusterInformers.mu 保护，只用于输出启动进度
+	synced bool
+	// failingSince 和 lastError 记录持续的 list/watch 错误的开始时间和最近一次错误的时间，
+	// restarting 表示已经开始重建该 informer，均由 clusterInformers.mu 保护
+	failingSince time.Time
+	lastError    time.Time
+	restarting   bool
+}
+
+// watchRecoveredInterval 是判断 list/watch 错误是否持续的间隔：reflector 重试的退避最长为 30 秒，
+// 两次错误的间隔超过该值时认为 watch 在其间已经恢复，重新计算错误的持续时间
+const watchRecoveredInterval = 2 * time.Minute
+
+// informerOptions 是创建 clusterInformers 时的配置
+type informerOptions struct {
+	// namespace 为监听的命名空间，为空表示所有命名空间；selector 不为 nil 时忽略
+	namespace string
+	// selector 不为 nil 时只监听标签匹配的命名空间
+	selector labels.Selector
+	// labelSelector 和 fieldSelector 不为 nil 时只监听匹配的对象
+	labelSelector labels.Selector
+	fieldSelector fields.Selector
+	// resyncPeriod 为 informer 的全量重新同步周期，为 0 时不进行周期性同步
+	resyncPeriod time.Duration
+	// startupSem 限制同时启动并进行初始同步的 informer 数量，为 nil 时不限制。多个集群共享同一个 startupSem
+	startupSem chan struct{}
+	// watchErrors 不为 nil 时处理所有 informer 的 list/watch 错误，resource 为被监听资源的名称，用于指标标签
+	watchErrors *watchErrorTracker
+	resource    string
+	// maxErrorDuration 大于 0 时，list/watch 错误持续超过该时间的 informer 会被丢弃并重新创建，需要设置 watchErrors
+	maxErrorDuration time.Duration
+}
+
+// clusterInformers 管理一个集群中被监听资源的 informer。
+// 未设置命名空间选择器时只有一个 informer，监听指定的命名空间或所有命名空间；
+// 设置了命名空间选择器时，为每个匹配的命名空间各创建一个 informer，并监听 Namespace 对象随命名空间的增删动态调整。
+type clusterInformers struct {
+	cluster     string
+	client      clientset.Interface
+	opts        informerOptions
+	newInformer informerFunc
+	handler     cache.ResourceEventHandler
+
+	// nsFactory 和 nsRegistration 只在设置了命名空间选择器时使用
+	nsFactory      informers.SharedInformerFactory
+	nsRegistration cache.ResourceEventHandlerRegistration
+
+	mu sync.Mutex
+	// ctx 在 start 之后才会设置，之后新增的命名空间 informer 会立即启动
+	ctx    context.Context
+	scoped map[string]*scopedInformer
+}
+
+// newClusterInformers 函数创建 clusterInformers。opts.selector 为 nil 时监听 opts.namespace（为空表示所有命名空间），
+// 否则监听标签匹配 opts.selector 的所有命名空间。
+func newClusterInformers(cluster string, client clientset.Interface, opts informerOptions, newInformer informerFunc, handler cache.ResourceEventHandler) (*clusterInformers, error) {
+	selector := opts.selector
+	ci := &clusterInformers{
+		cluster:     cluster,
+		client:      client,
+		opts:        opts,
+		newInformer: newInformer,
+		handler:     handler,
+		scoped:      make(map[string]*scopedInformer),
+	}
+
+	if selector == nil {
+		if err := ci.addNamespace(opts.namespace); err != nil {
+			return nil, err
+		}
+		return ci, nil
+	}
+
+	klog.InfoS("watching namespaces by label selector", "cluster", cluster, "selector", selector.String())
+	ci.nsFactory = informers.NewSharedInformerFactoryWithOptions(client, 0, informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+		opts.LabelSelector = selector.String()
+	}))
+	nsInformer := ci.nsFactory.Core().V1().Namespaces().Informer()
+	if opts.watchErrors != nil {
+		if err := nsInformer.SetWatchErrorHandler(opts.watchErrors.handler(cluster, "namespaces", nil)); err != nil {
+			return nil, fmt.Errorf("设置 watch 错误处理函数失败: %w", err)
+		}
+	}
+	// 列表请求已经按标签过滤，标签不再匹配的命名空间会以删除事件的形式出现
+	registration, err := nsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if ns, ok := obj.(*corev1.Namespace); ok {
+				if err := ci.addNamespace(ns.Name); err != nil {
+					klog.ErrorS(err, "failed to watch namespace", "cluster", cluster, "namespace", ns.Name)
+				}
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if ns, ok := obj.(*corev1.Namespace); ok {
+				ci.removeNamespace(ns.Name)
+			}
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("注册 Namespace 事件处理函数失败: %w", err)
+	}
+	ci.nsRegistration = registration
+	return ci, nil
+}
+
+// addNamespace 函数为 namespace 创建 informer，已经存在时不做任何操作。如果已经调用过 start，新的 informer 会立即启动。
+func (ci *clusterInformers) addNamespace(namespace string) error {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	if _, ok := ci.scoped[namespace]; ok {
+		return nil
+	}
+
+	s, err := ci.newScoped(namespace)
+	if err != nil {
+		return err
+	}
+	ci.scoped[namespace] = s
+	logV(componentInformer, 2).InfoS("watching namespace", "cluster", ci.cluster, "namespace", namespace)
+	if ci.ctx != nil {
+		ci.startScoped(s)
+	}
+	return nil
+}
+
+// newScoped 函数为 namespace 创建一个尚未启动的 scopedInformer，设置 watch 错误处理函数并注册事件处理函数
+func (ci *clusterInformers) newScoped(namespace string) (*scopedInformer, error) {
+	factory, informer, err := ci.newInformer(namespace)
+	if err != nil {
+		return nil, err
+	}
+	s := &scopedInformer{
+		factory:  factory,
+		informer: informer,
+	}
+	if ci.opts.watchErrors != nil {
+		var onError func(time.Time)
+		if ci.opts.maxErrorDuration > 0 {
+			onError = func(at time.Time) { ci.observeWatchError(namespace, s, at) }
+		}
+		// 必须在 informer 启动之前设置
+		if err := informer.SetWatchErrorHandler(ci.opts.watchErrors.handler(ci.cluster, ci.opts.resource, onError)); err != nil {
+			return nil, fmt.Errorf("设置 watch 错误处理函数失败: %w", err)
+		}
+	}
+	registration, err := informer.AddEventHandler(ci.handler)
+	if err != nil {
+		return nil, fmt.Errorf("注册事件处理函数失败: %w", err)
+	}
+	s.registration = registration
+	return s, nil
+}
+
+// observeWatchError 函数记录 namespace 的 informer s 在 at 发生的 list/watch 错误，
+// 错误持续超过 maxErrorDuration 时在后台重建该 informer。
+// 该函数在 reflector 的 goroutine 中调用，而停止 informer 需要等待 reflector 退出，因此不能在这里同步重建。
+func (ci *clusterInformers) observeWatchError(namespace string, s *scopedInformer, at time.Time) {
+	ci.mu.Lock()
+	if ci.scoped[namespace] != s || s.restarting {
+		// informer 已经被删除或正在重建
+		ci.mu.Unlock()
+		return
+	}
+	if s.failingSince.IsZero() || at.Sub(s.lastError) > watchRecoveredInterval {
+		s.failingSince = at
+	}
+	s.lastError = at
+	failing := at.Sub(s.failingSince)
+	restart := failing >= ci.opts.maxErrorDuration
+	s.restarting = restart
+	ci.mu.Unlock()
+
+	if restart {
+		go ci.restartNamespace(namespace, s, failing)
+	}
+}
+
+// restartNamespace 函数丢弃 namespace 的 informer old 并重新创建、启动一个新的 informer，
+// 而不是依赖 reflector 内部的退避重试。新 informer 完成同步后，
+// 旧缓存中存在而新缓存中不存在的对象在中断期间已被删除，为它们补发删除事件。
+func (ci *clusterInformers) restartNamespace(namespace string, old *scopedInformer, failing time.Duration) {
+	s, err := ci.newScoped(namespace)
+	if err != nil {
+		klog.ErrorS(err, "failed to recreate informer", "cluster", ci.cluster, "namespace", namespace, "resource", ci.opts.resource)
+		ci.mu.Lock()
+		old.restarting = false
+		old.failingSince = time.Time{}
+		ci.mu.Unlock()
+		return
+	}
+
+	ci.mu.Lock()
+	if ci.scoped[namespace] != old {
+		// 重建期间命名空间已经被删除
+		ci.mu.Unlock()
+		return
+	}
+	ci.scoped[namespace] = s
+	ctx := ci.ctx
+	ci.startScoped(s)
+	ci.mu.Unlock()
+
+	informerRestarts.WithLabelValues(ci.opts.resource).Inc()
+	klog.InfoS("restarting informer after persistent watch errors", "cluster", ci.cluster, "namespace", namespace, "resource", ci.opts.resource, "failingFor", failing.Round(time.Second))
+	if old.cancel != nil {
+		old.cancel()
+	}
+	old.factory.Shutdown()
+
+	if !cache.WaitForCacheSync(ctx.Done(), s.registration.HasSynced) {
+		return
+	}
+	current := s.informer.GetStore()
+	for _, key := range old.informer.GetStore().ListKeys() {
+		if _, exists, _ := current.GetByKey(key); exists {
+			continue
+		}
+		obj, exists, _ := old.informer.GetStore().GetByKey(key)
+		if !exists {
+			continue
+		}
+		ci.handler.OnDelete(cache.DeletedFinalStateUnknown{Key: key, Obj: obj})
+	}
+}
+
+// removeNamespace 函数停止并删除 namespace 的 informer
+func (ci *clusterInformers) removeNamespace(namespace string) {
+	ci.mu.Lock()
+	s, ok := ci.scoped[namespace]
+	delete(ci.scoped, namespace)
+	ci.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	klog.InfoS("stop watching namespace", "cluster", ci.cluster, "namespace", namespace)
+	if s.cancel != nil {
+		s.cancel()
+	}
+	go s.factory.Shutdown()
+}
+
+// startScoped 函数启动一个 informer，调用方需要持有 ci.mu。
+// 设置了 startupSem 时在后台等待信号量，informer 完成初始同步后释放，避免同时启动大量 informer 导致内存峰值过高。
+func (ci *clusterInformers) startScoped(s *scopedInformer) {
+	ctx, cancel := context.WithCancel(ci.ctx)
+	s.cancel = cancel
+	if ci.opts.startupSem == nil {
+		s.factory.Start(ctx.Done())
+		return
+	}
+
+	go func() {
+		select {
+		case ci.opts.startupSem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		defer func() { <-ci.opts.startupSem }()
+
+		s.factory.Start(ctx.Done())
+		if !cache.WaitForCacheSync(ctx.Done(), s.registration.HasSynced) {
+			return
+		}
+		ci.mu.Lock()
+		s.synced = true
+		synced := 0
+		for _, other := range ci.scoped {
+			if other.synced {
+				synced++
+			}
+		}
+		total := len(ci.scoped)
+		ci.mu.Unlock()
+		klog.InfoS("informer synced", "cluster", ci.cluster, "synced", synced, "total", total)
+	}()
+}
+
+// start 函数启动所有 informer，ctx 取消时全部停止
+func (ci *clusterInformers) start(ctx context.Context) {
+	ci.mu.Lock()
+	ci.ctx = ctx
+	for _, s := range ci.scoped {
+		ci.startScoped(s)
+	}
+	ci.mu.Unlock()
+
+	if ci.nsFactory != nil {
+		ci.nsFactory.Start(ctx.Done())
+	}
+}
+
+// hasSynced 返回所有 informer 是否都已完成初始同步。设置了命名空间选择器时还要求匹配的命名空间已经全部被发现。
+func (ci *clusterInformers) hasSynced() bool {
+	if ci.nsRegistration != nil && !ci.nsRegistration.HasSynced() {
+		return false
+	}
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	for _, s := range ci.scoped {
+		if !s.registration.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// unsynced 函数返回尚未完成初始同步的 informer 所监听的命名空间，监听所有命名空间时为空字符串
+func (ci *clusterInformers) unsynced() []string {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	var out []string
+	for namespace, s := range ci.scoped {
+		if !s.registration.HasSynced() {
+			out = append(out, namespace)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// informers 函数返回当前所有 informer，key 为监听的命名空间，监听所有命名空间时为空
+func (ci *clusterInformers) informers() map[string]cache.SharedIndexInformer {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	out := make(map[string]cache.SharedIndexInformer, len(ci.scoped))
+	for namespace, s := range ci.scoped {
+		out[namespace] = s.informer
+	}
+	return out
+}
+
+// scope 函数返回负责 namespace 的 informer，监听所有命名空间时只有一个 informer，集群级别的对象 namespace 为空
+func (ci *clusterInformers) scope(namespace string) (*scopedInformer, bool) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	s, ok := ci.scoped[namespace]
+	if !ok && ci.nsFactory == nil {
+		s, ok = ci.scoped[metav1.NamespaceAll]
+	}
+	return s, ok
+}
+
+// get 从缓存中获取 namespace 和 name 对应的对象，集群级别的对象 namespace 为空
+func (ci *clusterInformers) get(namespace, name string) (interface{}, bool, error) {
+	s, ok := ci.scope(namespace)
+	if !ok {
+		return nil, false, nil
+	}
+	// informer 的缓存始终使用 namespace/name 形式的 key，与控制器的 KeyFunc 无关
+	return s.informer.GetStore().GetByKey(cache.NewObjectName(namespace, name).String())
+}
+
+// shutdown 函数等待所有 informer 退出，调用前需要先取消传给 start 的 ctx
+func (ci *clusterInformers) shutdown() {
+	if ci.nsFactory != nil {
+		ci.nsFactory.Shutdown()
+	}
+	ci.mu.Lock()
+	scoped := make([]*scopedInformer, 0, len(ci.scoped))
+	for _, s := range ci.scoped {
+		scoped = append(scoped, s)
+	}
+	ci.mu.Unlock()
+	for _, s := range scoped {
+		s.factory.Shutdown()
+	}
+}
+
+// newInformerFactory 函数创建 SharedInformerFactory，namespace 不为空时只监听该命名空间，否则监听整个集群。
+// opts 中的标签和字段选择器会加到 list/watch 请求中，resyncPeriod 为 0 时不进行周期性的全量重新同步。
+func newInformerFactory(client clientset.Interface, namespace string, opts informerOptions) informers.SharedInformerFactory {
+	logWatchedNamespace(namespace)
+	factoryOpts := []informers.SharedInformerOption{informers.WithTweakListOptions(opts.tweakListOptions)}
+	if namespace != metav1.NamespaceAll {
+		factoryOpts = append(factoryOpts, informers.WithNamespace(namespace))
+	}
+	return informers.NewSharedInformerFactoryWithOptions(client, opts.resyncPeriod, factoryOpts...)
+}
+
+// newDynamicInformerFactory 函数创建基于 dynamic client 的 DynamicSharedInformerFactory，参数含义与 newInformerFactory 相同。
+// 从中获取的 informer 缓存的对象为 *unstructured.Unstructured。
+func newDynamicInformerFactory(client dynamic.Interface, namespace string, opts informerOptions) dynamicinformer.DynamicSharedInformerFactory {
+	logWatchedNamespace(namespace)
+	return dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, opts.resyncPeriod, namespace, opts.tweakListOptions)
+}
+
+// logWatchedNamespace 函数记录 informer 监听的命名空间
+func logWatchedNamespace(namespace string) {
+	if namespace == metav1.NamespaceAll {
+		klog.Info("监听所有命名空间")
+	} else {
+		klog.Infof("监听命名空间 %s", namespace)
+	}
+}
+
+// tweakListOptions 函数将 opts 中的标签和字段选择器加到 list/watch 请求中
+func (opts informerOptions) tweakListOptions(listOpts *metav1.ListOptions) {
+	if opts.labelSelector != nil {
+		listOpts.LabelSelector = opts.labelSelector.String()
+	}
+	if opts.fieldSelector != nil {
+		listOpts.FieldSelector = opts.fieldSelector.String()
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+// errNoKubeConfig 表示没有找到任何可用的 Kubernetes 配置
+var errNoKubeConfig = errors.New("未找到可用的 Kubernetes 配置：未指定 --kubeconfig，环境变量 KUBECONFIG 和 ~/.kube/config 均不可用，且当前不在集群内运行")
+
+// errContextNotFound 表示 kubeconfig 中不存在指定的 context
+var errContextNotFound = errors.New("context 不存在")
+
+// buildConfig 函数基于 clientcmd 的加载规则构建一个 Kubernetes 配置对象，优先级为：
+// 显式指定的 kubeconfig > 环境变量 KUBECONFIG > ~/.kube/config > 集群内配置。
+// kubeContext 不为空时使用 kubeconfig 中名称为 kubeContext 的 context，否则使用当前 context。
+// 没有找到任何配置时返回 errNoKubeConfig，配置存在但无效时返回描述具体原因的错误。
+func buildConfig(kubeconfig, kubeContext string) (*rest.Config, error) {
+	if kubeContext != "" {
+		if err := checkContextExists(kubeconfig, kubeContext); err != nil {
+			return nil, err
+		}
+	}
+	// 当加载到的配置为空且运行在集群中时，DeferredLoadingClientConfig 会自动回退到集群内配置
+	cfg, err := loadClientConfig(kubeconfig, kubeContext).ClientConfig()
+	if err != nil {
+		if clientcmd.IsEmptyConfig(err) {
+			return nil, errNoKubeConfig
+		}
+		return nil, fmt.Errorf("kubernetes 配置无效: %w", err)
+	}
+	return cfg, nil
+}
+
+// loadClientConfig 函数按照 clientcmd 的默认加载规则创建 ClientConfig
+func loadClientConfig(kubeconfig, kubeContext string) clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		loadingRules.ExplicitPath = kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+}
+
+// checkContextExists 函数检查 kubeconfig 中是否存在名称为 kubeContext 的 context，不存在时返回列出可用 context 的错误
+func checkContextExists(kubeconfig, kubeContext string) error {
+	raw, err := loadClientConfig(kubeconfig, "").RawConfig()
+	if err != nil {
+		return fmt.Errorf("读取 kubeconfig 失败: %w", err)
+	}
+	if _, ok := raw.Contexts[kubeContext]; ok {
+		return nil
+	}
+	available := make([]string, 0, len(raw.Contexts))
+	for name := range raw.Contexts {
+		available = append(available, name)
+	}
+	sort.Strings(available)
+	return fmt.Errorf("kubeconfig 中不存在名为 %q 的 context，可用的 context: %v: %w", kubeContext, available, errContextNotFound)
+}
+
+// contextName 函数返回连接集群时实际使用的 context 名称
+func contextName(kubeconfig, kubeContext string) (string, error) {
+	if kubeContext != "" {
+		return kubeContext, nil
+	}
+	raw, err := loadClientConfig(kubeconfig, "").RawConfig()
+	if err != nil {
+		return "", fmt.Errorf("读取 kubeconfig %s 失败: %w", kubeconfig, err)
+	}
+	if raw.CurrentContext == "" {
+		return "", fmt.Errorf("kubeconfig %s 没有设置 current-context", kubeconfig)
+	}
+	return raw.CurrentContext, nil
+}
+
+// transportSettings 是连接 API Server 的 HTTP 连接池参数，零值的字段使用 client-go 的默认值
+type transportSettings struct {
+	// maxIdleConns 为每个 API Server 保持的最大空闲连接数
+	maxIdleConns int
+	// idleConnTimeout 为空闲连接关闭前的最长空闲时间
+	idleConnTimeout time.Duration
+}
+
+// kubeTransport 由 realMain 根据 --kube-api-max-idle-conns 和 --kube-api-idle-conn-timeout 设置
+var kubeTransport transportSettings
+
+// apply 函数通过 config.Wrap 调整 client-go 创建的 *http.Transport 的连接池参数，并记录实际生效的参数。
+// 大量并发的 API 调用在空闲连接不足时会反复建立新连接，导致连接抖动和本地端口耗尽。
+func (s transportSettings) apply(config *rest.Config) {
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		t, ok := rt.(*http.Transport)
+		if !ok {
+			klog.InfoS("API client transport is not an *http.Transport, connection pool settings not applied", "transport", fmt.Sprintf("%T", rt))
+			return rt
+		}
+		if t == http.DefaultTransport && s != (transportSettings{}) {
+			// 未配置 TLS 时 client-go 直接使用全局的 http.DefaultTransport，不能修改
+			t = t.Clone()
+		}
+		// 所有请求都发往同一个 API Server，因此每个主机的空闲连接数与总数相同
+		if s.maxIdleConns > 0 {
+			t.MaxIdleConns = s.maxIdleConns
+			t.MaxIdleConnsPerHost = s.maxIdleConns
+		}
+		if s.idleConnTimeout > 0 {
+			t.IdleConnTimeout = s.idleConnTimeout
+		}
+		klog.InfoS("API client transport", "host", config.Host, "maxIdleConns", t.MaxIdleConns, "maxIdleConnsPerHost", t.MaxIdleConnsPerHost, "idleConnTimeout", t.IdleConnTimeout)
+		return t
+	})
+}
+
+// newClientset 函数构建 Kubernetes 配置并设置客户端限速参数和连接池参数，然后创建 clientset。
+func newClientset(kubeconfig, kubeContext string, qps float32, burst int) (*clientset.Clientset, error) {
+	config, err := buildConfig(kubeconfig, kubeContext)
+	if err != nil {
+		return nil, err
+	}
+	config.QPS = qps
+	config.Burst = burst
+	kubeTransport.apply(config)
+	return clientset.NewForConfig(config)
+}
+
+// newDynamicClient 函数使用与 newClientset 相同的配置创建 dynamic client
+func newDynamicClient(kubeconfig, kubeContext string, qps float32, burst int) (*dynamic.DynamicClient, error) {
+	config, err := buildConfig(kubeconfig, kubeContext)
+	if err != nil {
+		return nil, err
+	}
+	config.QPS = qps
+	config.Burst = burst
+	kubeTransport.apply(config)
+	return dynamic.NewForConfig(config)
+}
+
+// connectWithRetry 函数创建 clientset 并通过 ServerVersion 确认可以连接 API Server。
+// 失败时按指数退避重试，最多重试 timeout，避免节点启动期间 API Server 短暂不可用导致 Pod 反复崩溃。
+// 没有找到配置或 context 不存在等重试也无法恢复的错误会立即返回。
+func connectWithRetry(kubeconfig, kubeContext string, qps float32, burst int, timeout time.Duration) (*clientset.Clientset, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	backoff := wait.Backoff{
+		Duration: time.Second,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    math.MaxInt32,
+		Cap:      30 * time.Second,
+	}
+	var client *clientset.Clientset
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		c, err := newClientset(kubeconfig, kubeContext, qps, burst)
+		if errors.Is(err, errNoKubeConfig) || errors.Is(err, errContextNotFound) {
+			return false, err
+		}
+		if err == nil {
+			_, err = c.Discovery().ServerVersion()
+		}
+		if err != nil {
+			lastErr = err
+			klog.ErrorS(err, "failed to connect to API server, retrying", "kubeconfig", kubeconfig, "context", kubeContext)
+			return false, nil
+		}
+		client = c
+		return true, nil
+	})
+	if wait.Interrupted(err) && lastErr != nil {
+		return nil, fmt.Errorf("%s 内无法连接 API Server: %w", timeout, lastErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// reloadOnSIGHUP 函数在收到 SIGHUP 信号时调用 reload 重新创建 clientset，ctx 取消时停止监听。
+func reloadOnSIGHUP(ctx context.Context, reload func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				klog.Info("接收到 SIGHUP 信号，重新加载 kubeconfig")
+				reload()
+			}
+		}
+	}()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// leaderLogKey 是 ConfigMap 中保存领导权变更记录的键
+const leaderLogKey = "transitions"
+
+// leaderTransition 记录一次领导权变更
+type leaderTransition struct {
+	Time           time.Time `json:"time"`
+	PreviousLeader string    `json:"previousLeader,omitempty"`
+	NewLeader      string    `json:"newLeader"`
+}
+
+// leaderLog 将领导权变更记录追加到一个 ConfigMap 中，与内存中的 /leaders 历史不同，这些记录在 Pod 重启后仍然保留，
+// 便于事后分析。只有新的领导者写入记录，避免多个副本重复记录同一次变更。
+type leaderLog struct {
+	configMaps typedcorev1.ConfigMapsGetter
+	namespace  string
+	name       string
+	// size 为保存的最大记录数，超过时删除最旧的记录
+	size int
+}
+
+// newLeaderLog 函数创建一个写入 namespace 中名为 name 的 ConfigMap、最多保存 size 条记录的 leaderLog
+func newLeaderLog(configMaps typedcorev1.ConfigMapsGetter, namespace, name string, size int) *leaderLog {
+	return &leaderLog{configMaps: configMaps, namespace: namespace, name: name, size: size}
+}
+
+// record 函数记录 leader 成为领导者。上一任领导者取自 ConfigMap 中最近的一条记录，因此刚启动的实例也能记录完整的变更；
+// 最近一条记录的领导者已经是 leader 时不重复记录。ConfigMap 不存在时自动创建，更新冲突时重试。
+func (l *leaderLog) record(ctx context.Context, leader string, at time.Time) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := l.configMaps.ConfigMaps(l.namespace).Get(ctx, l.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name:   l.name,
+				Labels: map[string]string{managedByLabel: controllerName},
+			}}
+		} else if err != nil {
+			return err
+		}
+
+		var transitions []leaderTransition
+		if data := cm.Data[leaderLogKey]; data != "" {
+			if err := json.Unmarshal([]byte(data), &transitions); err != nil {
+				return fmt.Errorf("解析 ConfigMap %s 中的领导权变更记录失败: %w", l.name, err)
+			}
+		}
+		previous := ""
+		if n := len(transitions); n > 0 {
+			previous = transitions[n-1].NewLeader
+		}
+		if previous == leader {
+			return nil
+		}
+		transitions = append(transitions, leaderTransition{Time: at.UTC(), PreviousLeader: previous, NewLeader: leader})
+		if len(transitions) > l.size {
+			transitions = transitions[len(transitions)-l.size:]
+		}
+		data, err := json.Marshal(transitions)
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[leaderLogKey] = string(data)
+
+		if cm.ResourceVersion == "" {
+			_, err = l.configMaps.ConfigMaps(l.namespace).Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// 其他实例刚刚创建了该 ConfigMap，按冲突处理以便重新读取
+				return apierrors.NewConflict(corev1.Resource("configmaps"), l.name, err)
+			}
+			return err
+		}
+		_, err = l.configMaps.ConfigMaps(l.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// leaderObservation 记录一次观察到的领导者
+type leaderObservation struct {
+	Identity   string    `json:"identity"`
+	ObservedAt time.Time `json:"observedAt"`
+}
+
+// leaderHistory 是一个固定容量的环形缓冲区，保存最近观察到的领导者，用于排查领导权频繁切换的问题。
+// 实现了 http.Handler，以 JSON 数组的形式按时间从旧到新返回记录。
+type leaderHistory struct {
+	mu      sync.Mutex
+	entries []leaderObservation
+	next    int
+	full    bool
+}
+
+// newLeaderHistory 函数创建一个最多保存 size 条记录的 leaderHistory
+func newLeaderHistory(size int) *leaderHistory {
+	return &leaderHistory{entries: make([]leaderObservation, size)}
+}
+
+// record 函数记录一次领导者变更，缓冲区已满时覆盖最旧的记录
+func (h *leaderHistory) record(identity string, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.entries) == 0 {
+		return
+	}
+	h.entries[h.next] = leaderObservation{Identity: identity, ObservedAt: at}
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// snapshot 函数按时间从旧到新返回当前保存的所有记录
+func (h *leaderHistory) snapshot() []leaderObservation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.full {
+		return append([]leaderObservation{}, h.entries[:h.next]...)
+	}
+	out := make([]leaderObservation, 0, len(h.entries))
+	out = append(out, h.entries[h.next:]...)
+	return append(out, h.entries[:h.next]...)
+}
+
+func (h *leaderHistory) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.snapshot()); err != nil {
+		klog.Errorf("写入领导者历史失败: %v", err)
+	}
+}
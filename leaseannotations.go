@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// parseLeaseAnnotations 函数解析 key=val,key2=val2 形式的租约注解，key 必须是合法的注解名称
+func parseLeaseAnnotations(spec string) (map[string]string, error) {
+	annotations := map[string]string{}
+	for _, item := range splitList(spec) {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("无效的租约注解 %q，格式应为 key=value", item)
+		}
+		key = strings.TrimSpace(key)
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("租约注解名称 %q 无效: %s", key, strings.Join(errs, "; "))
+		}
+		annotations[key] = strings.TrimSpace(value)
+	}
+	return annotations, nil
+}
+
+// newLeaderLock 函数创建领导者选举使用的资源锁。annotations 不为空时只支持 lease 锁，返回一个在持有租约期间写入这些注解的 AnnotatedLeaseLock。
+func newLeaderLock(lockType, name, namespace, id string, client lockClient, annotations map[string]string) (resourcelock.Interface, error) {
+	if len(annotations) == 0 {
+		return newResourceLock(lockType, name, namespace, id, client)
+	}
+	if lockType != lockTypeLease {
+		return nil, fmt.Errorf("租约注解只支持 %s 锁，当前为 %s", lockTypeLease, lockType)
+	}
+	return &AnnotatedLeaseLock{
+		LeaseMeta:   metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Client:      client,
+		LockConfig:  resourcelock.ResourceLockConfig{Identity: id},
+		Annotations: annotations,
+	}, nil
+}
+
+// AnnotatedLeaseLock 与 resourcelock.LeaseLock 相同，但持有者写入租约时同时写入 Annotations，
+// 例如 Pod IP、节点名称和版本，使 kubectl get lease -o yaml 可以看到当前领导者的运维信息。
+// client-go 的 LeaseLock 不支持写入注解，因此这里自行实现。释放租约时删除这些注解，租约上的其他注解保持不变。
+type AnnotatedLeaseLock struct {
+	// LeaseMeta 只需要填写 Name 和 Namespace
+	LeaseMeta   metav1.ObjectMeta
+	Client      coordinationv1client.LeasesGetter
+	LockConfig  resourcelock.ResourceLockConfig
+	Annotations map[string]string
+	lease       *coordinationv1.Lease
+}
+
+// Get 返回选举记录
+func (ll *AnnotatedLeaseLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	lease, err := ll.Client.Leases(ll.LeaseMeta.Namespace).Get(ctx, ll.LeaseMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	ll.lease = lease
+	record := resourcelock.LeaseSpecToLeaderElectionRecord(&lease.Spec)
+	recordBytes, err := json.Marshal(*record)
+	if err != nil {
+		return nil, nil, err
+	}
+	return record, recordBytes, nil
+}
+
+// Create 尝试创建一个领导者选举记录
+func (ll *AnnotatedLeaseLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ll.LeaseMeta.Name,
+			Namespace: ll.LeaseMeta.Namespace,
+		},
+		Spec: resourcelock.LeaderElectionRecordToLeaseSpec(&ler),
+	}
+	ll.applyAnnotations(lease, ler)
+	var err error
+	ll.lease, err = ll.Client.Leases(ll.LeaseMeta.Namespace).Create(ctx, lease, metav1.CreateOptions{})
+	return err
+}
+
+// Update 更新已存在的领导者选举记录
+func (ll *AnnotatedLeaseLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	if ll.lease == nil {
+		return errors.New("lease not initialized, call get or create first")
+	}
+	ll.lease.Spec = resourcelock.LeaderElectionRecordToLeaseSpec(&ler)
+	ll.applyAnnotations(ll.lease, ler)
+	lease, err := ll.Client.Leases(ll.LeaseMeta.Namespace).Update(ctx, ll.lease, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	ll.lease = lease
+	return nil
+}
+
+// applyAnnotations 函数在 ler 的持有者为当前实例时写入 Annotations，否则（例如释放租约时）删除这些注解
+func (ll *AnnotatedLeaseLock) applyAnnotations(lease *coordinationv1.Lease, ler resourcelock.LeaderElectionRecord) {
+	if ler.HolderIdentity != ll.LockConfig.Identity {
+		for key := range ll.Annotations {
+			delete(lease.Annotations, key)
+		}
+		return
+	}
+	if lease.Annotations == nil {
+		lease.Annotations = make(map[string]string, len(ll.Annotations))
+	}
+	for key, value := range ll.Annotations {
+		lease.Annotations[key] = value
+	}
+}
+
+// RecordEvent 在设置了 EventRecorder 时记录事件
+func (ll *AnnotatedLeaseLock) RecordEvent(s string) {
+	if ll.LockConfig.EventRecorder == nil {
+		return
+	}
+	events := fmt.Sprintf("%v %v", ll.LockConfig.Identity, s)
+	subject := &coordinationv1.Lease{ObjectMeta: ll.lease.ObjectMeta}
+	ll.LockConfig.EventRecorder.Eventf(subject, corev1.EventTypeNormal, "LeaderElection", events)
+}
+
+// Describe 返回锁的描述信息
+func (ll *AnnotatedLeaseLock) Describe() string {
+	return fmt.Sprintf("%v/%v", ll.LeaseMeta.Namespace, ll.LeaseMeta.Name)
+}
+
+// Identity 返回锁的持有者身份
+func (ll *AnnotatedLeaseLock) Identity() string {
+	return ll.LockConfig.Identity
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// leaseTransitionsGauge 为锁对象中记录的领导权变更次数（Lease 的 spec.leaseTransitions），是整个集群范围内的权威计数
+var leaseTransitionsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "controller_lease_transitions",
+	Help: "锁对象中记录的领导权变更次数",
+}, []string{"lease"})
+
+func init() {
+	prometheus.MustRegister(leaseTransitionsGauge)
+}
+
+// leaseTransitions 从锁对象中读取领导权变更次数并更新 controller_lease_transitions。
+// 与只统计本实例观察到的变更的 controller_leader_transitions_total 不同，刚启动的副本也能报告完整的计数。
+type leaseTransitions struct {
+	// mu 保护 lock，锁的实现会缓存最近读到的对象，不能并发调用
+	mu   sync.Mutex
+	lock resourcelock.Interface
+}
+
+// newLeaseTransitions 函数创建一个从 lock 读取领导权变更次数的 leaseTransitions，lock 不能与选举共用同一个实例
+func newLeaseTransitions(lock resourcelock.Interface) *leaseTransitions {
+	return &leaseTransitions{lock: lock}
+}
+
+// update 函数读取一次锁对象并更新指标，读取失败时保留上一次的值
+func (t *leaseTransitions) update(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	record, _, err := t.lock.Get(ctx)
+	if err != nil {
+		logV(componentLeaderElection, 2).InfoS("failed to read lease transitions", "lock", t.lock.Describe(), "err", err)
+		return
+	}
+	leaseTransitionsGauge.WithLabelValues(t.lock.Describe()).Set(float64(record.LeaderTransitions))
+}
+
+// poll 函数每隔 interval 更新一次指标，直到 ctx 取消
+func (t *leaseTransitions) poll(ctx context.Context, interval time.Duration) {
+	wait.UntilWithContext(ctx, t.update, interval)
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+const (
+	lockTypeLease     = "lease"
+	lockTypeConfigMap = "configmap"
+	lockTypeEndpoints = "endpoints"
+)
+
+// lockClient 是资源锁读写锁对象使用的客户端，锁在每次读写时才调用这些 getter
+type lockClient interface {
+	coordinationv1client.LeasesGetter
+	corev1client.ConfigMapsGetter
+	corev1client.EndpointsGetter
+}
+
+// newResourceLock 函数根据 lockType 构建对应的资源锁实现，未知的锁类型返回错误。
+func newResourceLock(lockType, name, namespace, id string, client lockClient) (resourcelock.Interface, error) {
+	meta := metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+	}
+	lockConfig := resourcelock.ResourceLockConfig{
+		Identity: id,
+	}
+
+	switch lockType {
+	case lockTypeLease:
+		return &resourcelock.LeaseLock{
+			LeaseMeta:  meta,
+			Client:     client,
+			LockConfig: lockConfig,
+		}, nil
+	case lockTypeConfigMap:
+		return &ConfigMapLock{
+			ConfigMapMeta: meta,
+			Client:        client,
+			LockConfig:    lockConfig,
+		}, nil
+	case lockTypeEndpoints:
+		return &EndpointsLock{
+			EndpointsMeta: meta,
+			Client:        client,
+			LockConfig:    lockConfig,
+		}, nil
+	case lockTypeRedis:
+		return newRedisLock(name, namespace, lockConfig)
+	default:
+		return nil, fmt.Errorf("未知的锁类型 %q，可选值为 %s、%s、%s、%s", lockType, lockTypeLease, lockTypeConfigMap, lockTypeEndpoints, lockTypeRedis)
+	}
+}
+
+// verifyLockReleased 函数在退出前轮询锁对象，确认 id 已经不再是持有者（持有者被清空或已变更为其他实例），
+// 最多等待 timeout，超时仍未确认时返回 false。
+func verifyLockReleased(lock resourcelock.Interface, id string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := wait.PollUntilContextCancel(ctx, 500*time.Millisecond, true, func(ctx context.Context) (bool, error) {
+		record, _, err := lock.Get(ctx)
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			logV(componentLeaderElection, 2).InfoS("failed to get lock while verifying release", "lock", lock.Describe(), "err", err)
+			return false, nil
+		}
+		return record.HolderIdentity != id, nil
+	})
+	return err == nil
+}
+
+// checkLockHealth 函数由领导者每隔 interval 调用一次，确认锁对象仍然存在并且以 id 为持有者，直到 ctx 取消。
+// 锁对象被手动删除或持有者被清空时立即以 id 为持有者重新写入，而不是等到下一次续约失败；
+// 持有者变成了其他实例或锁对象无法解析时只能交给选举处理。发现的异常都通过 report 报告。
+func checkLockHealth(ctx context.Context, lock resourcelock.Interface, id string, interval, leaseDuration time.Duration, report func(message string)) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		record, _, err := lock.Get(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		now := metav1.NewTime(time.Now())
+		reclaim := resourcelock.LeaderElectionRecord{
+			HolderIdentity:       id,
+			LeaseDurationSeconds: int(leaseDuration / time.Second),
+			AcquireTime:          now,
+			RenewTime:            now,
+		}
+		switch {
+		case apierrors.IsNotFound(err):
+			report(fmt.Sprintf("锁对象 %s 不存在，重新创建", lock.Describe()))
+			if err := lock.Create(ctx, reclaim); err != nil {
+				klog.ErrorS(err, "failed to recreate lock", "lock", lock.Describe())
+			}
+		case err != nil:
+			report(fmt.Sprintf("读取锁对象 %s 失败: %v", lock.Describe(), err))
+		case record.HolderIdentity == "":
+			report(fmt.Sprintf("锁对象 %s 的持有者被清空，重新写入", lock.Describe()))
+			reclaim.LeaderTransitions = record.LeaderTransitions
+			if err := lock.Update(ctx, reclaim); err != nil {
+				klog.ErrorS(err, "failed to reclaim lock", "lock", lock.Describe())
+			}
+		case record.HolderIdentity != id:
+			report(fmt.Sprintf("锁对象 %s 的持有者为 %s 而不是当前实例 %s", lock.Describe(), record.HolderIdentity, id))
+		}
+	}, interval)
+}
+
+// ensureNamespace 函数在 namespace 不存在时创建该命名空间，用于自动创建租约锁所在的命名空间。
+// 多个副本同时启动时可能同时尝试创建，AlreadyExists 视为成功。
+func ensureNamespace(ctx context.Context, client clientset.Interface, namespace string) error {
+	_, err := client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("获取命名空间 %s 失败: %w", namespace, err)
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+	_, err = client.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("创建命名空间 %s 失败: %w", namespace, err)
+	}
+	klog.InfoS("created lease namespace", "namespace", namespace)
+	return nil
+}
+
+// lockObjectReference 函数返回资源锁对应对象的引用，用于记录领导权变更事件。
+// Redis 锁在集群中没有对应的对象，事件记录到控制器所在的 Pod 上，无法确定 Pod 时返回 nil。
+func lockObjectReference(lockType, name, namespace string) *corev1.ObjectReference {
+	if lockType == lockTypeRedis {
+		return controllerPodReference()
+	}
+	ref := &corev1.ObjectReference{
+		Name:      name,
+		Namespace: namespace,
+	}
+	switch lockType {
+	case lockTypeConfigMap:
+		ref.APIVersion, ref.Kind = "v1", "ConfigMap"
+	case lockTypeEndpoints:
+		ref.APIVersion, ref.Kind = "v1", "Endpoints"
+	default:
+		ref.APIVersion, ref.Kind = "coordination.k8s.io/v1", "Lease"
+	}
+	return ref
+}
+
+// controllerPodReference 函数返回控制器所在 Pod 的引用：名称取 POD_NAME 环境变量或主机名，
+// 命名空间取 POD_NAMESPACE 环境变量或 ServiceAccount 的命名空间文件。不在 Pod 中运行时返回 nil。
+func controllerPodReference() *corev1.ObjectReference {
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		ns, ok := podNamespace()
+		if !ok {
+			return nil
+		}
+		namespace = ns
+	}
+	name := os.Getenv("POD_NAME")
+	if name == "" {
+		hostname, err := os.Hostname()
+		if err != nil || hostname == "" {
+			return nil
+		}
+		name = hostname
+	}
+	return &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Name: name, Namespace: namespace}
+}
+
+// decodeLeaderRecord 函数从对象注解中解析领导者选举记录，注解不存在时返回空记录。
+func decodeLeaderRecord(annotations map[string]string) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	var record resourcelock.LeaderElectionRecord
+	recordStr, found := annotations[resourcelock.LeaderElectionRecordAnnotationKey]
+	recordBytes := []byte(recordStr)
+	if found {
+		if err := json.Unmarshal(recordBytes, &record); err != nil {
+			return nil, nil, err
+		}
+	}
+	return &record, recordBytes, nil
+}
+
+// ConfigMapLock 是基于 ConfigMap 注解实现的资源锁，client-go 已移除该实现，这里保留以兼容无法访问 coordination.k8s.io 的集群。
+type ConfigMapLock struct {
+	// ConfigMapMeta 只需要填写 Name 和 Namespace
+	ConfigMapMeta metav1.ObjectMeta
+	Client        corev1client.ConfigMapsGetter
+	LockConfig    resourcelock.ResourceLockConfig
+	cm            *corev1.ConfigMap
+}
+
+// Get 返回选举记录
+func (cml *ConfigMapLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	cm, err := cml.Client.ConfigMaps(cml.ConfigMapMeta.Namespace).Get(ctx, cml.ConfigMapMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	cml.cm = cm
+	if cml.cm.Annotations == nil {
+		cml.cm.Annotations = make(map[string]string)
+	}
+	return decodeLeaderRecord(cml.cm.Annotations)
+}
+
+// Create 尝试创建一个领导者选举记录
+func (cml *ConfigMapLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	recordBytes, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+	cml.cm, err = cml.Client.ConfigMaps(cml.ConfigMapMeta.Namespace).Create(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cml.ConfigMapMeta.Name,
+			Namespace: cml.ConfigMapMeta.Namespace,
+			Annotations: map[string]string{
+				resourcelock.LeaderElectionRecordAnnotationKey: string(recordBytes),
+			},
+		},
+	}, metav1.CreateOptions{})
+	return err
+}
+
+// Update 更新已存在的领导者选举记录
+func (cml *ConfigMapLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	if cml.cm == nil {
+		return errors.New("configmap not initialized, call get or create first")
+	}
+	recordBytes, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+	if cml.cm.Annotations == nil {
+		cml.cm.Annotations = make(map[string]string)
+	}
+	cml.cm.Annotations[resourcelock.LeaderElectionRecordAnnotationKey] = string(recordBytes)
+	cm, err := cml.Client.ConfigMaps(cml.ConfigMapMeta.Namespace).Update(ctx, cml.cm, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	cml.cm = cm
+	return nil
+}
+
+// RecordEvent 在设置了 EventRecorder 时记录事件
+func (cml *ConfigMapLock) RecordEvent(s string) {
+	if cml.LockConfig.EventRecorder == nil {
+		return
+	}
+	events := fmt.Sprintf("%v %v", cml.LockConfig.Identity, s)
+	subject := &corev1.ConfigMap{ObjectMeta: cml.cm.ObjectMeta}
+	cml.LockConfig.EventRecorder.Eventf(subject, corev1.EventTypeNormal, "LeaderElection", events)
+}
+
+// Describe 返回锁的描述信息
+func (cml *ConfigMapLock) Describe() string {
+	return fmt.Sprintf("%v/%v", cml.ConfigMapMeta.Namespace, cml.ConfigMapMeta.Name)
+}
+
+// Identity 返回锁的持有者身份
+func (cml *ConfigMapLock) Identity() string {
+	return cml.LockConfig.Identity
+}
+
+// EndpointsLock 是基于 Endpoints 注解实现的资源锁，client-go 已移除该实现，这里保留以兼容无法访问 coordination.k8s.io 的集群。
+type EndpointsLock struct {
+	// EndpointsMeta 只需要填写 Name 和 Namespace
+	EndpointsMeta metav1.ObjectMeta
+	Client        corev1client.EndpointsGetter
+	LockConfig    resourcelock.ResourceLockConfig
+	e             *corev1.Endpoints
+}
+
+// Get 返回选举记录
+func (el *EndpointsLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	ep, err := el.Client.Endpoints(el.EndpointsMeta.Namespace).Get(ctx, el.EndpointsMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	el.e = ep
+	if el.e.Annotations == nil {
+		el.e.Annotations = make(map[string]string)
+	}
+	return decodeLeaderRecord(el.e.Annotations)
+}
+
+// Create 尝试创建一个领导者选举记录
+func (el *EndpointsLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	recordBytes, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+	el.e, err = el.Client.Endpoints(el.EndpointsMeta.Namespace).Create(ctx, &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      el.EndpointsMeta.Name,
+			Namespace: el.EndpointsMeta.Namespace,
+			Annotations: map[string]string{
+				resourcelock.LeaderElectionRecordAnnotationKey: string(recordBytes),
+			},
+		},
+	}, metav1.CreateOptions{})
+	return err
+}
+
+// Update 更新已存在的领导者选举记录
+func (el *EndpointsLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	if el.e == nil {
+		return errors.New("endpoint not initialized, call get or create first")
+	}
+	recordBytes, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+	if el.e.Annotations == nil {
+		el.e.Annotations = make(map[string]string)
+	}
+	el.e.Annotations[resourcelock.LeaderElectionRecordAnnotationKey] = string(recordBytes)
+	e, err := el.Client.Endpoints(el.EndpointsMeta.Namespace).Update(ctx, el.e, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	el.e = e
+	return nil
+}
+
+// RecordEvent 在设置了 EventRecorder 时记录事件
+func (el *EndpointsLock) RecordEvent(s string) {
+	if el.LockConfig.EventRecorder == nil {
+		return
+	}
+	events := fmt.Sprintf("%v %v", el.LockConfig.Identity, s)
+	subject := &corev1.Endpoints{ObjectMeta: el.e.ObjectMeta}
+	el.LockConfig.EventRecorder.Eventf(subject, corev1.EventTypeNormal, "LeaderElection", events)
+}
+
+// Describe 返回锁的描述信息
+func (el *EndpointsLock) Describe() string {
+	return fmt.Sprintf("%v/%v", el.EndpointsMeta.Namespace, el.EndpointsMeta.Name)
+}
+
+// Identity 返回锁的持有者身份
+func (el *EndpointsLock) Identity() string {
+	return el.LockConfig.Identity
+}
+
+// timedLock 包装一个资源锁，记录领导者每次续约写入锁对象的耗时，用于发现 API Server 响应缓慢导致的意外失去领导权。
+// 获取和释放领导权的写入不计入续约耗时。
+type timedLock struct {
+	resourcelock.Interface
+}
+
+// Update 更新锁对象，写入的记录表示续约时将耗时记录到 controller_lease_renew_duration_seconds
+func (l timedLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	start := time.Now()
+	err := l.Interface.Update(ctx, ler)
+	if isRenewal(ler, l.Identity()) {
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		leaseRenewDuration.WithLabelValues(l.Identity(), result).Observe(time.Since(start).Seconds())
+	}
+	return err
+}
+
+// isRenewal 函数判断 ler 是否为 id 的续约记录：获取领导权时 AcquireTime 与 RenewTime 相同，续约时保留原来的 AcquireTime，
+// 释放领导权时持有者为空。
+func isRenewal(ler resourcelock.LeaderElectionRecord, id string) bool {
+	return ler.HolderIdentity == id && !ler.AcquireTime.Equal(&ler.RenewTime)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// 可以通过 --component-verbosity 单独设置日志级别的子系统
+const (
+	componentLeaderElection = "leader-election"
+	componentInformer       = "informer"
+	componentReconcile      = "reconcile"
+)
+
+// componentLevels 保存各子系统的日志级别，只在启动时由 setupComponentVerbosity 写入
+var componentLevels = map[string]klog.Level{}
+
+// setupComponentVerbosity 函数解析 leader-election=2,informer=6 形式的配置并设置各子系统的日志级别
+func setupComponentVerbosity(spec string) error {
+	levels := map[string]klog.Level{}
+	for _, item := range splitList(spec) {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("无效的子系统日志级别 %q，格式应为 子系统=级别", item)
+		}
+		name = strings.TrimSpace(name)
+		switch name {
+		case componentLeaderElection, componentInformer, componentReconcile:
+		default:
+			return fmt.Errorf("未知的子系统 %q，可选值为 %s、%s、%s", name, componentLeaderElection, componentInformer, componentReconcile)
+		}
+		level, err := strconv.ParseUint(strings.TrimSpace(value), 10, 31)
+		if err != nil {
+			return fmt.Errorf("子系统 %s 的日志级别 %q 无效: %w", name, value, err)
+		}
+		levels[name] = klog.Level(level)
+	}
+	componentLevels = levels
+	return nil
+}
+
+// logV 函数与 klog.V 相同，但子系统单独设置了日志级别时使用子系统的级别而不是全局的 -v。
+func logV(component string, level klog.Level) klog.Verbose {
+	l, ok := componentLevels[component]
+	if !ok {
+		return klog.V(level)
+	}
+	if level <= l {
+		// V(0) 总是开启的
+		return klog.V(0)
+	}
+	return klog.Verbose{}
+}
+
+// setupLogging 函数根据 format 配置 klog 的输出格式。json 格式下日志通过 slog 的 JSONHandler 输出，
+// klog.InfoS 等结构化日志的键值对会作为 JSON 字段输出。
+func setupLogging(format string) error {
+	switch format {
+	case logFormatText:
+		return nil
+	case logFormatJSON:
+		// 日志级别由 klog 的 -v 参数控制，这里不再额外过滤
+		handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.Level(math.MinInt)})
+		klog.SetLogger(logr.FromSlogHandler(handler))
+		return nil
+	default:
+		return fmt.Errorf("未知的日志格式 %q，可选值为 %s、%s", format, logFormatText, logFormatJSON)
+	}
+}
+
+// withReconcileLogger 函数返回附带了本次 reconcile 的 logger 的 ctx：logger 带有 key 和随机生成的 reconcileID，
+// ctx 中有有效的 span 时还带有 traceID。Reconciler 通过 logr.FromContext(ctx) 或 klog.FromContext(ctx) 取出 logger，
+// 输出的日志自动带有正在处理的对象，并发 reconcile 时也能区分每一次处理。
+func withReconcileLogger(ctx context.Context, key string) context.Context {
+	logger := klog.FromContext(ctx).WithValues("key", key, "reconcileID", uuid.NewString())
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		logger = logger.WithValues("traceID", sc.TraceID().String())
+	}
+	return logr.NewContext(ctx, logger)
+}
@@ -3,101 +3,1070 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
 	"os"
 	"os/signal"
-	"syscall"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	clientset "k8s.io/client-go/kubernetes"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 )
 
-// buildConfig 函数基于给定的 kubeconfig 构建一个 Kubernetes 配置对象，如果 kubeconfig 为空，则使用集群内配置。
-func buildConfig(kubeconfig string) (*rest.Config, error) {
-	if kubeconfig != "" {
-		cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			return nil, err
+// envOrDefault 函数返回环境变量 envKey 的值，如果环境变量未设置或为空，则返回 fallback。
+func envOrDefault(envKey, fallback string) string {
+	if v, ok := os.LookupEnv(envKey); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+// resolveIdentity 函数返回未通过 --id 指定时的持有者身份，以及身份的来源，依次尝试：
+// POD_NAME 环境变量、主机名（在 Pod 中即为 Pod 名称）、随机 UUID。namespace 不为空时追加 _<namespace> 后缀，
+// 使不同命名空间中同名的 Pod 也不会冲突，在 kubectl get lease 中可以直接看出领导者是哪个 Pod。
+func resolveIdentity(namespace string) (id, source string) {
+	id, source = os.Getenv("POD_NAME"), "POD_NAME"
+	if id == "" {
+		if hostname, err := os.Hostname(); err == nil && hostname != "" {
+			id, source = hostname, "hostname"
 		}
-		return cfg, nil
 	}
+	if id == "" {
+		id, source = uuid.New().String(), "uuid"
+	}
+	if namespace != "" {
+		id += "_" + namespace
+	}
+	return id, source
+}
+
+// serviceAccountNamespaceFile 是 Pod 中挂载的 ServiceAccount 所在命名空间的文件，即 Pod 自身的命名空间
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 
-	cfg, err := rest.InClusterConfig()
+// podNamespace 函数从 ServiceAccount 挂载的文件中读取 Pod 所在的命名空间，不在 Pod 中运行或未挂载 token 时返回 false
+func podNamespace() (string, bool) {
+	data, err := os.ReadFile(serviceAccountNamespaceFile)
 	if err != nil {
-		return nil, err
+		return "", false
 	}
-	return cfg, nil
+	ns := strings.TrimSpace(string(data))
+	return ns, ns != ""
+}
+
+// validateLeaseTiming 函数校验租约时间参数必须满足 LeaseDuration > RenewDeadline > RetryPeriod，否则领导者选举会出现异常行为。
+func validateLeaseTiming(leaseDuration, renewDeadline, retryPeriod time.Duration) error {
+	if leaseDuration <= renewDeadline {
+		return fmt.Errorf("lease-duration (%s) 必须大于 renew-deadline (%s)", leaseDuration, renewDeadline)
+	}
+	if renewDeadline <= retryPeriod {
+		return fmt.Errorf("renew-deadline (%s) 必须大于 retry-period (%s)", renewDeadline, retryPeriod)
+	}
+	return nil
 }
 
 func main() {
+	code := realMain()
+	klog.Flush()
+	os.Exit(code)
+}
+
+// sleepJitter 函数随机等待 [0, max) 之间的一段时间，ctx 在等待期间取消时返回 false。max 不大于 0 时立即返回 true。
+func sleepJitter(ctx context.Context, max time.Duration) bool {
+	if max <= 0 {
+		return true
+	}
+	delay := time.Duration(rand.Int63n(int64(max)))
+	klog.InfoS("waiting before joining leader election", "delay", delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// realMain 函数完成参数解析、领导者选举和控制器运行，并返回进程退出码：
+// 正常退出（例如收到 SIGTERM）时返回 0，意外失去领导权时返回 1，便于进程管理者区分两种情况。
+// os.Exit 只在 main 中调用，保证这里所有通过 defer 注册的清理工作都能执行。
+func realMain() int {
 	klog.InitFlags(nil)
 
 	var kubeconfig string
 	var leaseLockName string
 	var leaseLockNamespace string
 	var id string
+	var leaseDuration time.Duration
+	var renewDeadline time.Duration
+	var retryPeriod time.Duration
+	var healthAddr string
+	var metricsAddr string
+	var lockType string
+	var shutdownTimeout time.Duration
+	var logFormat string
+	var watchNamespace string
+	var dryRun bool
+	var showVersion bool
+	var workers int
+	var kubeAPIQPS float64
+	var kubeAPIBurst int
+	var maxReconcileRetries int
+	var enableLeaderElection bool
+	var enablePprof bool
+	var pprofAddr string
+	var leaderElectionTimeout time.Duration
+	var reconcilerName string
+	var kubeContexts string
+	var leaseCluster string
+	var releaseVerifyTimeout time.Duration
+	var namespaceLabelSelector string
+	var skipRBACCheck bool
+	var releaseOnCancel bool
+	var otelEndpoint string
+	var resyncPeriod time.Duration
+	var requireCRD bool
+	var reconcileTimeout time.Duration
+	var enableWebhook bool
+	var webhookAddr string
+	var tlsCertFile string
+	var tlsKeyFile string
+	var eventDedupWindow time.Duration
+	var leaderHistorySize int
+	var componentVerbosity string
+	var informerStartupConcurrency int
+	var startupRetryTimeout time.Duration
+	var observeOnly bool
+	var labelSelector string
+	var fieldSelector string
+	var fullSyncPeriod time.Duration
+	var shutdownSignals string
+	var disableForceExit bool
+	var createLeaseNamespace bool
+	var readFromCache bool
+	var leaderPriority int
+	var writeForbiddenThreshold int
+	var writeAccessCheckInterval time.Duration
+	var configFile string
+	var leaderLogConfigMap string
+	var leaderLogSize int
+	var watchGVR string
+	var bindAddressFamily string
+	var cacheSyncTimeout time.Duration
+	var shardCount int
+	var shardSpec string
+	var lockCheckInterval time.Duration
+	var metricsTLSCert string
+	var metricsTLSKey string
+	var metricsClientCA string
+	var watchErrorThreshold int
+	var watchErrorWindow time.Duration
+	var informerMaxErrorDuration time.Duration
+	var startupJitter time.Duration
+	var runOnce bool
+	var adminToken string
+	var httpShutdownTimeoutFlag time.Duration
+	var disableLeaseReleaseOnPanic bool
+	var panicThreshold int
+	var leaseAnnotationsSpec string
+	var reconcileDebounce time.Duration
+	var leaseTransitionsInterval time.Duration
+	var generationChangedOnly bool
+	var leaderElectionHealthzTolerance time.Duration
+	var kubeAPIMaxIdleConns int
+	var kubeAPIIdleConnTimeout time.Duration
+	var auditLogPath string
+	var auditRedactFields string
+	var redisAddr string
+	var leaderStablePeriod time.Duration
+	var excludeNamespaces string
+	var scaleTargetGVR string
+	var watchChildStatus string
+	var requireMinServerVersion string
+	var maxConcurrentPerNamespace int
+	var enableMutatingWebhook bool
 
-	flag.StringVar(&kubeconfig, "kubeconfig", "", "kubeconfig 文件的绝对路径")
-	flag.StringVar(&id, "id", uuid.New().String(), "持有者ID身份")
-	flag.StringVar(&leaseLockName, "lease-lock-name", "", "租用锁资源名称")
-	flag.StringVar(&leaseLockNamespace, "lease-lock-namespace", "", "租用锁资源命名空间")
+	// 优先级：显式指定的命令行参数 > 环境变量 > 默认值
+	flag.StringVar(&kubeconfig, "kubeconfig", "", "kubeconfig 文件的绝对路径，未指定时依次尝试环境变量 KUBECONFIG、~/.kube/config 和集群内配置；指定多个文件（逗号分隔）时同时监听多个集群")
+	flag.StringVar(&id, "id", "", "持有者ID身份，为空时依次使用环境变量 POD_NAME、主机名、随机 UUID，并追加 _<Pod 所在的命名空间> 后缀")
+	flag.StringVar(&leaseLockName, "lease-lock-name", envOrDefault("LEASE_LOCK_NAME", ""), "租用锁资源名称，可通过环境变量 LEASE_LOCK_NAME 设置")
+	flag.StringVar(&leaseLockNamespace, "lease-lock-namespace", envOrDefault("LEASE_LOCK_NAMESPACE", ""), "租用锁资源命名空间，可通过环境变量 LEASE_LOCK_NAMESPACE 设置；均为空时在 Pod 中自动使用 ServiceAccount 所在的命名空间")
+	flag.DurationVar(&leaseDuration, "lease-duration", 60*time.Second, "非领导者候选人在尝试获取领导权之前需要等待的时长")
+	flag.DurationVar(&renewDeadline, "renew-deadline", 15*time.Second, "领导者在放弃领导权之前重试续约的时长")
+	flag.DurationVar(&retryPeriod, "retry-period", 5*time.Second, "候选人两次尝试获取或续约领导权之间的间隔")
+	flag.StringVar(&healthAddr, "health-addr", ":8081", "健康检查服务监听地址")
+	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "Prometheus 指标服务监听地址")
+	flag.StringVar(&lockType, "lock-type", lockTypeLease, "资源锁类型，可选值为 lease、configmap、endpoints、redis")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "优雅关闭时等待处理中的任务完成的最长时间")
+	flag.StringVar(&logFormat, "log-format", logFormatText, "日志格式，可选值为 text、json")
+	flag.StringVar(&watchNamespace, "watch-namespace", "", "控制器监听的命名空间，为空表示监听所有命名空间；与租约锁所在的命名空间相互独立")
+	flag.BoolVar(&dryRun, "dry-run", false, "为 true 时只记录控制器将要执行的写操作而不实际修改集群")
+	flag.BoolVar(&showVersion, "version", false, "打印版本信息并退出")
+	flag.IntVar(&workers, "workers", 2, "并发处理工作队列的 worker 数量")
+	flag.Float64Var(&kubeAPIQPS, "kube-api-qps", float64(rest.DefaultQPS), "访问 Kubernetes API Server 的 QPS 限制")
+	flag.IntVar(&kubeAPIBurst, "kube-api-burst", rest.DefaultBurst, "访问 Kubernetes API Server 的突发请求数限制")
+	flag.IntVar(&maxReconcileRetries, "max-reconcile-retries", 5, "reconcile 失败后的最大重试次数，超过后丢弃该任务")
+	flag.BoolVar(&enableLeaderElection, "enable-leader-election", true, "是否启用领导者选举，单副本部署时可以关闭，此时不需要租约锁及 coordination.k8s.io 的权限")
+	flag.BoolVar(&enablePprof, "enable-pprof", false, "是否开启 /debug/pprof/* 性能分析接口，默认关闭；开启后应通过 NetworkPolicy 限制访问")
+	flag.StringVar(&pprofAddr, "pprof-addr", "", "性能分析服务的独立监听地址，为空时注册在指标服务上；仅在开启 enable-pprof 时生效")
+	flag.DurationVar(&leaderElectionTimeout, "leader-election-timeout", 0, "等待成为领导者的最长时间，超时后以非领导者身份退出；为 0 时一直重试")
+	flag.StringVar(&reconcilerName, "reconciler", reconcilerLogging, "使用的 reconciler，可选值为 logging（监听 Pod 并记录日志）、deployment-scaler（根据注解调整 Deployment 副本数）、secret-mirror（根据注解将 Secret 复制到其他命名空间）、configmap-reload（ConfigMap 内容变化时触发引用它的 Deployment 滚动更新）、ready-condition（在 --watch-gvr 指定的资源上设置 Ready condition）、scale（根据注解通过 scale 子资源调整 --scale-target-gvr 指定资源的副本数）")
+	flag.StringVar(&kubeContexts, "context", "", "使用 kubeconfig 中指定的 context，指定多个 context（逗号分隔）时同时监听多个集群；只能与单个 kubeconfig 文件一起使用")
+	flag.StringVar(&kubeContexts, "kube-context", "", "--context 的别名")
+	flag.StringVar(&leaseCluster, "lease-cluster", "", "多集群模式下租约锁所在的集群（context 名称），为空时使用第一个集群")
+	flag.DurationVar(&releaseVerifyTimeout, "release-verify-timeout", 10*time.Second, "退出前确认租约已经释放的最长等待时间")
+	flag.StringVar(&namespaceLabelSelector, "namespace-label-selector", "", "只监听标签匹配该选择器的命名空间（例如 team=payments），并随命名空间的增删动态调整；不能与 watch-namespace 同时使用")
+	flag.BoolVar(&skipRBACCheck, "skip-rbac-check", false, "跳过启动时基于 SelfSubjectAccessReview 的 RBAC 权限预检查")
+	flag.BoolVar(&releaseOnCancel, "leader-election-release-on-cancel", true, "退出时是否主动释放租约；频繁滚动重启时可以关闭，避免所有副本同时重新竞选")
+	flag.StringVar(&otelEndpoint, "otel-endpoint", "", "OpenTelemetry OTLP gRPC 导出地址（例如 otel-collector:4317），为空时不开启链路追踪")
+	flag.DurationVar(&resyncPeriod, "resync-period", 10*time.Minute, "informer 全量重新同步的周期，为 0 时关闭周期性同步。周期越短越能及时修正漂移，但会增加 reconcile 次数")
+	flag.BoolVar(&requireCRD, "require-crd", false, "被监听的资源（例如 CRD）不存在时立即失败；默认按指数退避等待资源安装")
+	flag.DurationVar(&reconcileTimeout, "reconcile-timeout", 2*time.Minute, "单次 reconcile 的最长执行时间，超时按 reconcile 失败处理，受 --max-reconcile-retries 限制，为 0 时不限制")
+	flag.BoolVar(&enableWebhook, "enable-webhook", false, "是否启动准入 webhook 服务，只有领导者提供服务")
+	flag.StringVar(&webhookAddr, "webhook-bind-address", ":9443", "准入 webhook HTTPS 服务的监听地址")
+	flag.StringVar(&tlsCertFile, "tls-cert-file", "", "准入 webhook 使用的 TLS 证书文件路径")
+	flag.StringVar(&tlsKeyFile, "tls-key-file", "", "准入 webhook 使用的 TLS 私钥文件路径")
+	flag.DurationVar(&eventDedupWindow, "event-dedup-window", time.Minute, "同一对象上 reason 相同的事件在该时间窗口内合并为一个事件并累加计数，为 0 时使用 client-go 默认的聚合规则")
+	flag.IntVar(&leaderHistorySize, "leader-history-size", 16, "/leaders 调试接口保存的最近领导者记录数量")
+	flag.StringVar(&componentVerbosity, "component-verbosity", "", "按子系统设置日志级别，格式与 --vmodule 类似，例如 leader-election=1,informer=6,reconcile=4；未设置的子系统使用 -v")
+	flag.IntVar(&informerStartupConcurrency, "informer-startup-concurrency", 4, "同时启动并进行初始同步的 informer 数量上限，监听大量命名空间时可以降低启动时的内存峰值；为 0 时不限制")
+	flag.DurationVar(&startupRetryTimeout, "startup-retry-timeout", 2*time.Minute, "启动时连接 API Server 失败的最长重试时间，超过后退出")
+	flag.BoolVar(&observeOnly, "observe-only", false, "只监听锁对象并记录领导者变更（日志、指标和 /leaders），不参与选举也不运行控制器循环")
+	flag.StringVar(&labelSelector, "label-selector", "", "只监听标签匹配该选择器的对象（例如 app=web），可以减少 API Server 和控制器的内存占用")
+	flag.StringVar(&fieldSelector, "field-selector", "", "只监听字段匹配该选择器的对象（例如 status.phase=Running），可用字段取决于被监听的资源")
+	flag.DurationVar(&fullSyncPeriod, "full-sync-period", time.Hour, "从 API Server 全量列出被监听对象并与缓存比较的周期，用于发现 watch 重连期间丢失的事件（包括删除）并清理孤儿子对象，为 0 时关闭")
+	flag.StringVar(&shutdownSignals, "shutdown-signals", "SIGTERM,SIGINT", "触发优雅退出的信号，逗号分隔")
+	flag.BoolVar(&disableForceExit, "disable-force-exit", false, "关闭优雅退出期间再次收到终止信号时立即强制退出的行为")
+	flag.BoolVar(&createLeaseNamespace, "create-lease-namespace", false, "租约锁所在的命名空间不存在时自动创建，需要 namespaces 的 get 和 create 权限")
+	flag.BoolVar(&readFromCache, "read-from-cache", true, "reconcile 时优先从 informer 缓存读取被监听的对象，缓存未命中时才请求 API Server；关闭后每次都直接请求 API Server")
+	flag.IntVar(&leaderPriority, "leader-priority", 0, "领导者选举优先级，优先级更高的实例会抢占当前的领导者，例如让金丝雀版本接管；默认 0 时与标准选举行为相同，只支持 lease 锁")
+	flag.IntVar(&writeForbiddenThreshold, "write-forbidden-threshold", 3, "写操作连续返回 403 Forbidden 达到该次数时进入只读模式，停止写操作但继续提供指标和健康检查，为 0 时关闭")
+	flag.DurationVar(&writeAccessCheckInterval, "write-access-check-interval", 30*time.Second, "只读模式下通过 SelfSubjectAccessReview 检查写权限是否恢复的间隔")
+	flag.StringVar(&configFile, "config-file", "", "YAML 配置文件路径，键为驼峰形式的参数名（例如 leaseDuration、watchNamespace），命令行参数优先于配置文件")
+	flag.StringVar(&leaderLogConfigMap, "leader-log-configmap", "", "不为空时，新的领导者将领导权变更记录（时间、上一任领导者、新领导者）追加到 lease-lock-namespace 中该名称的 ConfigMap，在 Pod 重启后仍然保留")
+	flag.IntVar(&leaderLogSize, "leader-log-size", 100, "leader-log-configmap 中保存的最大记录数，超过时删除最旧的记录")
+	flag.StringVar(&watchGVR, "watch-gvr", "", "通过 dynamic client 监听的资源，格式为 group/version/resource（例如 apps/v1/deployments、example.com/v1/widgets），核心组写成 v1/pods；为空时监听 reconciler 指定的资源")
+	flag.StringVar(&bindAddressFamily, "bind-address-family", "tcp", "健康检查、指标、性能分析和 webhook 服务监听使用的地址族：tcp（IPv4 和 IPv6）、tcp4 或 tcp6，单栈 IPv6 集群中可以指定为 tcp6")
+	flag.DurationVar(&cacheSyncTimeout, "cache-sync-timeout", 2*time.Minute, "informer 缓存超过该时间仍未完成初始同步时记录未同步的 informer，缓存同步完成前 /readyz 不会报告就绪，为 0 时不记录")
+	flag.IntVar(&shardCount, "shard-count", 1, "分片数量，大于 1 时每个分片使用一个名为 <lease-lock-name>-<分片编号> 的锁独立选举，多个实例分别处理各自持有的分片，对象按 key 的一致性哈希分配到分片")
+	flag.StringVar(&shardSpec, "shards", "", "当前实例参与竞选的分片编号，逗号分隔，例如 0,1；为空时参与所有分片的竞选，仅在 shard-count 大于 1 时生效")
+	flag.DurationVar(&lockCheckInterval, "lock-check-interval", 30*time.Second, "领导者检查锁对象是否仍然存在并以自己为持有者的间隔，锁对象被删除或持有者被清空时立即重新写入，为 0 时关闭")
+	flag.StringVar(&metricsTLSCert, "metrics-tls-cert", "", "指标服务的 TLS 证书文件，与 metrics-tls-key 同时指定时指标服务使用 HTTPS，文件更新后自动重新加载")
+	flag.StringVar(&metricsTLSKey, "metrics-tls-key", "", "指标服务的 TLS 私钥文件")
+	flag.StringVar(&metricsClientCA, "metrics-client-ca", "", "指标服务的客户端 CA 证书文件，指定时要求 Prometheus 提供由该 CA 签发的客户端证书（mTLS）")
+	flag.IntVar(&watchErrorThreshold, "watch-error-threshold", 5, "watch-error-window 内 informer 的 list/watch 错误次数达到该值时 /readyz 报告未就绪，为 0 时只记录错误")
+	flag.DurationVar(&watchErrorWindow, "watch-error-window", 5*time.Minute, "统计 informer list/watch 错误次数的时间窗口")
+	flag.DurationVar(&informerMaxErrorDuration, "informer-max-error-duration", 0, "informer 的 list/watch 错误持续超过该时间时丢弃并重新创建该 informer，而不是继续依赖 reflector 的退避重试；为 0 时不重建")
+	flag.DurationVar(&startupJitter, "leader-election-startup-jitter", 0, "开始选举前随机等待的最长时间，避免集群整体重启后所有副本同时竞选，为 0 时不等待")
+	flag.BoolVar(&runOnce, "run-once", false, "成为领导者并完成缓存同步后对所有被监听的对象执行一次 reconcile 然后退出，全部成功时退出码为 0，否则为 1，适合以 Job 的形式运行")
+	flag.StringVar(&adminToken, "admin-token", "", "不为空时在指标服务上提供 POST /stepdown 接口，请求携带 Authorization: Bearer <admin-token> 时领导者释放租约、等待其他副本接管后重新参与选举，用于排空节点而不删除 Pod")
+	flag.DurationVar(&httpShutdownTimeoutFlag, "http-shutdown-timeout", 5*time.Second, "关闭 HTTP 服务（webhook、指标、健康检查）时等待处理中的请求完成的最长时间，超时后强制关闭剩余的连接")
+	flag.BoolVar(&disableLeaseReleaseOnPanic, "disable-lease-release-on-panic", false, "Reconciler 发生 panic 的次数达到 panic-threshold 时停止控制器循环，不再续约也不释放租约，在租约自然过期后以退出码 1 退出，避免其他副本基于不一致的状态继续工作")
+	flag.IntVar(&panicThreshold, "panic-threshold", 3, "开启 disable-lease-release-on-panic 时，Reconciler 发生 panic 的次数达到该值后保留租约并停止工作")
+	flag.StringVar(&leaseAnnotationsSpec, "lease-annotations", "", "持有租约期间写入租约的注解，格式为 key=val,key2=val2，例如 Pod IP、节点名称和版本，只支持 lease 锁")
+	flag.DurationVar(&reconcileDebounce, "reconcile-debounce", 0, "大于 0 时对象变化后延迟该时间再 reconcile，期间同一对象的多次变化合并为一次 reconcile，为 0 时立即处理")
+	flag.DurationVar(&leaseTransitionsInterval, "lease-transitions-poll-interval", 30*time.Second, "从锁对象读取领导权变更次数并更新 controller_lease_transitions 指标的间隔，为 0 时只在领导者变更时更新")
+	flag.BoolVar(&generationChangedOnly, "generation-changed-only", false, "只处理 metadata.generation 发生变化的更新事件，忽略只修改 status 的更新；不填写 generation 的资源（例如 Pod）不要开启")
+	flag.DurationVar(&leaderElectionHealthzTolerance, "leader-election-healthz-tolerance", 0, "领导者超过 lease-duration 加上该时间仍未成功续约时 /healthz 返回失败，使 kubelet 重启 Pod，为 0 时等于 lease-duration")
+	flag.IntVar(&kubeAPIMaxIdleConns, "kube-api-max-idle-conns", 0, "与 API Server 保持的最大空闲连接数，大量并发的 API 调用时调大以避免反复建立连接，为 0 时使用 client-go 的默认值")
+	flag.DurationVar(&kubeAPIIdleConnTimeout, "kube-api-idle-conn-timeout", 0, "与 API Server 的空闲连接关闭前的最长空闲时间，为 0 时使用 client-go 的默认值")
+	flag.StringVar(&auditLogPath, "audit-log-path", "", "不为空时以 JSON Lines 格式记录 Reconciler 执行的每一次写操作（对象、操作和写入前后的差异），为 - 时写入标准输出")
+	flag.StringVar(&auditRedactFields, "audit-redact-fields", defaultAuditRedactFields, "审计日志中需要脱敏的字段，逗号分隔，格式为 [Kind:]field.path，省略 Kind 时作用于所有资源")
+	flag.StringVar(&redisAddr, "redis-addr", "", "lock-type 为 redis 时 Redis 的地址（host:port），密码从 REDIS_PASSWORD 环境变量读取")
+	flag.DurationVar(&leaderStablePeriod, "leader-stable-period", 0, "成为领导者后需要连续持有领导权的时间，达到该时间且缓存完成同步后才开始 reconcile，失去领导权时重新计时，为 0 时缓存同步后立即开始")
+	flag.StringVar(&excludeNamespaces, "exclude-namespaces", "kube-system,kube-public,kube-node-lease", "监听所有命名空间时跳过的命名空间，逗号分隔，其中的对象不会进入工作队列；指定了 --watch-namespace 时不生效")
+	flag.StringVar(&scaleTargetGVR, "scale-target-gvr", "", "scale reconciler 调整副本数的资源，格式与 --watch-gvr 相同（例如 apps/v1/statefulsets、example.com/v1/widgets），资源需要提供 scale 子资源；控制器通过 dynamic client 监听该资源")
+	flag.StringVar(&watchChildStatus, "watch-child-status", "", "通过 dynamic client 监听的子资源，格式与 --watch-gvr 相同（例如 v1/pods），子对象的 status 发生变化或子对象被删除时将其 controller OwnerReference 指向的被监听对象重新入队；为空时不监听")
+	flag.StringVar(&requireMinServerVersion, "require-min-server-version", "", "要求的最低 API Server 版本（例如 1.24），低于该版本时直接退出；为空时只在不提供 coordination.k8s.io/v1 Lease 的旧集群上输出警告")
+	flag.IntVar(&maxConcurrentPerNamespace, "max-concurrent-per-namespace", 0, "同一个命名空间中最多同时处理的对象数量，超出时稍后重新入队，避免一个命名空间占满所有 worker；为 0 时不限制")
+	flag.BoolVar(&enableMutatingWebhook, "enable-mutating-webhook", false, "在准入 webhook 服务上提供 /mutate，为对象填充默认值并以 JSON Patch 返回，需要同时指定 --enable-webhook")
 	flag.Parse()
 
-	if leaseLockName == "" {
-		klog.Fatal("无法获取租用锁资源名称（缺少租用锁名称标志）.")
+	if configFile != "" {
+		cfg, err := loadConfig(configFile)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		if err := cfg.validate(flag.CommandLine); err != nil {
+			klog.Fatal(err)
+		}
+		if err := cfg.apply(flag.CommandLine); err != nil {
+			klog.Fatal(err)
+		}
+		klog.InfoS("loaded config file", "path", configFile, "settings", len(cfg))
+	}
+
+	if showVersion {
+		fmt.Println(versionString())
+		return 0
 	}
+
+	// 未指定租约命名空间时默认使用控制器自身所在的命名空间，显式指定的 --lease-lock-namespace 或 LEASE_LOCK_NAMESPACE 优先
 	if leaseLockNamespace == "" {
-		klog.Fatal("无法获取租约锁资源命名空间（缺少 lease-lock-namespace 标志）.")
+		if ns, ok := podNamespace(); ok {
+			leaseLockNamespace = ns
+			klog.InfoS("using pod namespace for lease lock", "namespace", ns, "source", serviceAccountNamespaceFile)
+		}
+	}
+
+	if err := setupComponentVerbosity(componentVerbosity); err != nil {
+		klog.Fatal(err)
+	}
+	if err := setupLogging(logFormat); err != nil {
+		klog.Fatal(err)
+	}
+
+	klog.InfoS("starting controller", "version", version, "commit", commit, "buildDate", buildDate)
+
+	// 显式指定的 --id 原样使用；Pod 所在的命名空间依次取 POD_NAMESPACE 环境变量、ServiceAccount 的命名空间文件，都没有时使用租约的命名空间
+	idSource := "flag"
+	if id == "" {
+		ns, ok := podNamespace()
+		if !ok {
+			ns = leaseLockNamespace
+		}
+		id, idSource = resolveIdentity(envOrDefault("POD_NAMESPACE", ns))
+	}
+	klog.InfoS("resolved holder identity", "id", id, "source", idSource)
+
+	if workers < 1 {
+		klog.Fatalf("workers 必须大于 0，当前为 %d", workers)
+	}
+	var namespaceSelector labels.Selector
+	if namespaceLabelSelector != "" {
+		if watchNamespace != "" {
+			klog.Fatal("不能同时指定 watch-namespace 和 namespace-label-selector")
+		}
+		selector, err := labels.Parse(namespaceLabelSelector)
+		if err != nil {
+			klog.Fatalf("namespace-label-selector 格式错误: %v", err)
+		}
+		namespaceSelector = selector
+	}
+	var objectLabelSelector labels.Selector
+	if labelSelector != "" {
+		selector, err := labels.Parse(labelSelector)
+		if err != nil {
+			klog.Fatalf("label-selector 格式错误: %v", err)
+		}
+		objectLabelSelector = selector
+	}
+	var objectFieldSelector fields.Selector
+	if fieldSelector != "" {
+		selector, err := fields.ParseSelector(fieldSelector)
+		if err != nil {
+			klog.Fatalf("field-selector 格式错误: %v", err)
+		}
+		objectFieldSelector = selector
+	}
+	if (metricsTLSCert == "") != (metricsTLSKey == "") {
+		klog.Fatal("metrics-tls-cert 和 metrics-tls-key 必须同时指定")
+	}
+	if metricsClientCA != "" && metricsTLSCert == "" {
+		klog.Fatal("metrics-client-ca 需要同时指定 metrics-tls-cert 和 metrics-tls-key")
+	}
+	if err := setListenNetwork(bindAddressFamily, healthAddr, metricsAddr, pprofAddr, webhookAddr); err != nil {
+		klog.Fatal(err)
+	}
+	var dynamicResource schema.GroupVersionResource
+	if watchGVR != "" {
+		gvr, err := parseGVR(watchGVR)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		dynamicResource = gvr
+	}
+	if scaleTargetGVR != "" {
+		if reconcilerName != reconcilerScale {
+			klog.Fatalf("scale-target-gvr 只能与 --reconciler=%s 一起使用", reconcilerScale)
+		}
+		gvr, err := parseGVR(scaleTargetGVR)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		if !dynamicResource.Empty() && dynamicResource != gvr {
+			klog.Fatalf("scale-target-gvr %s 与 watch-gvr %s 不一致", gvr, dynamicResource)
+		}
+		dynamicResource = gvr
+	}
+	var childStatusResource schema.GroupVersionResource
+	if watchChildStatus != "" {
+		gvr, err := parseGVR(watchChildStatus)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		childStatusResource = gvr
+	}
+	if resyncPeriod < 0 {
+		klog.Fatalf("resync-period 不能为负数，当前为 %s", resyncPeriod)
+	}
+	signals, err := parseSignals(shutdownSignals)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if fullSyncPeriod < 0 {
+		klog.Fatalf("full-sync-period 不能为负数，当前为 %s", fullSyncPeriod)
+	}
+	if reconcileTimeout < 0 {
+		klog.Fatalf("reconcile-timeout 不能为负数，当前为 %s", reconcileTimeout)
+	}
+	if startupRetryTimeout <= 0 {
+		klog.Fatalf("startup-retry-timeout 必须大于 0，当前为 %s", startupRetryTimeout)
+	}
+	if informerMaxErrorDuration < 0 {
+		klog.Fatalf("informer-max-error-duration 不能为负数，当前为 %s", informerMaxErrorDuration)
+	}
+	if informerStartupConcurrency < 0 {
+		klog.Fatalf("informer-startup-concurrency 不能为负数，当前为 %d", informerStartupConcurrency)
+	}
+	if leaderLogSize < 1 {
+		klog.Fatalf("leader-log-size 必须大于 0，当前为 %d", leaderLogSize)
+	}
+	if leaderHistorySize < 1 {
+		klog.Fatalf("leader-history-size 必须大于 0，当前为 %d", leaderHistorySize)
+	}
+	if eventDedupWindow < 0 {
+		klog.Fatalf("event-dedup-window 不能为负数，当前为 %s", eventDedupWindow)
+	}
+	if enableMutatingWebhook && !enableWebhook {
+		klog.Fatal("enable-mutating-webhook 需要同时指定 --enable-webhook")
+	}
+	if enableWebhook && (tlsCertFile == "" || tlsKeyFile == "") {
+		klog.Fatal("启用准入 webhook 时必须指定 --tls-cert-file 和 --tls-key-file")
+	}
+	if enableLeaderElection || observeOnly {
+		if leaseLockName == "" {
+			klog.Fatal("无法获取租用锁资源名称（缺少租用锁名称标志）.")
+		}
+		if leaseLockNamespace == "" {
+			klog.Fatal("无法获取租约锁资源命名空间（缺少 lease-lock-namespace 标志，且无法从 ServiceAccount 检测 Pod 所在的命名空间）.")
+		}
+		if err := validateLeaseTiming(leaseDuration, renewDeadline, retryPeriod); err != nil {
+			klog.Fatal(err)
+		}
+	}
+	leaseAnnotations, err := parseLeaseAnnotations(leaseAnnotationsSpec)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if len(leaseAnnotations) > 0 && lockType != lockTypeLease {
+		klog.Fatalf("lease-annotations 只支持 %s 锁，当前为 %s", lockTypeLease, lockType)
+	}
+	if kubeAPIMaxIdleConns < 0 {
+		klog.Fatalf("kube-api-max-idle-conns 不能为负数，当前为 %d", kubeAPIMaxIdleConns)
+	}
+	if kubeAPIIdleConnTimeout < 0 {
+		klog.Fatalf("kube-api-idle-conn-timeout 不能为负数，当前为 %s", kubeAPIIdleConnTimeout)
+	}
+	if auditLogPath != "" {
+		logger, closeAuditLog, err := newAuditLogger(auditLogPath, auditRedactFields)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		defer func() {
+			if err := closeAuditLog(); err != nil {
+				klog.ErrorS(err, "failed to close audit log", "path", auditLogPath)
+			}
+		}()
+		auditLog = logger
+		klog.InfoS("audit log enabled", "path", auditLogPath, "redact", auditRedactFields)
+	}
+	kubeTransport = transportSettings{maxIdleConns: kubeAPIMaxIdleConns, idleConnTimeout: kubeAPIIdleConnTimeout}
+	requiredServerVersion, err := parseServerVersion(requireMinServerVersion)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if maxConcurrentPerNamespace < 0 {
+		klog.Fatalf("max-concurrent-per-namespace 不能为负数，当前为 %d", maxConcurrentPerNamespace)
+	}
+	if leaderStablePeriod < 0 {
+		klog.Fatalf("leader-stable-period 不能为负数，当前为 %s", leaderStablePeriod)
+	}
+	if lockType == lockTypeRedis && redisAddr == "" {
+		klog.Fatalf("lock-type 为 %s 时必须指定 --redis-addr", lockTypeRedis)
+	}
+	redisLockAddr, redisLockPassword = redisAddr, os.Getenv("REDIS_PASSWORD")
+	if leaderElectionHealthzTolerance < 0 {
+		klog.Fatalf("leader-election-healthz-tolerance 不能为负数，当前为 %s", leaderElectionHealthzTolerance)
+	}
+	if leaseTransitionsInterval < 0 {
+		klog.Fatalf("lease-transitions-poll-interval 不能为负数，当前为 %s", leaseTransitionsInterval)
+	}
+	if reconcileDebounce < 0 {
+		klog.Fatalf("reconcile-debounce 不能为负数，当前为 %s", reconcileDebounce)
+	}
+	if disableLeaseReleaseOnPanic {
+		if !enableLeaderElection {
+			klog.Fatal("disable-lease-release-on-panic 需要开启领导者选举")
+		}
+		if shardCount > 1 {
+			klog.Fatal("disable-lease-release-on-panic 不支持分片模式")
+		}
+		if panicThreshold < 1 {
+			klog.Fatalf("panic-threshold 必须大于 0，当前为 %d", panicThreshold)
+		}
+	}
+	if shardCount < 1 {
+		klog.Fatalf("shard-count 必须大于 0，当前为 %d", shardCount)
+	}
+	if adminToken != "" && (!enableLeaderElection || observeOnly || shardCount > 1 || runOnce) {
+		klog.Fatal("admin-token 需要开启领导者选举，不支持 observe-only、分片模式和 run-once")
+	}
+	var assignedShards []int
+	if shardCount > 1 {
+		if !enableLeaderElection {
+			klog.Fatal("shard-count 大于 1 时必须开启领导者选举")
+		}
+		if observeOnly || leaderPriority != 0 || leaderLogConfigMap != "" || runOnce {
+			klog.Fatal("分片模式不支持 observe-only、leader-priority、leader-log-configmap 和 run-once")
+		}
+		shards, err := parseShards(shardSpec, shardCount)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		assignedShards = shards
+	}
+	if httpShutdownTimeoutFlag <= 0 {
+		klog.Fatalf("http-shutdown-timeout 必须大于 0，当前为 %s", httpShutdownTimeoutFlag)
+	}
+	httpShutdownTimeout = httpShutdownTimeoutFlag
+	if startupJitter < 0 {
+		klog.Fatalf("leader-election-startup-jitter 不能为负数，当前为 %s", startupJitter)
+	}
+	if leaderPriority < 0 {
+		klog.Fatalf("leader-priority 不能为负数，当前为 %d", leaderPriority)
+	}
+	if leaderPriority != 0 && lockType != lockTypeLease {
+		klog.Fatalf("leader-priority 只支持 %s 锁", lockTypeLease)
 	}
 
 	// lease lock 的名字和命名空间、持有者标识等
 	// 分布式系统通常需要租约（Lease）；租约提供了一种机制来锁定共享资源并协调集合成员之间的活动。 在 Kubernetes 中，租约概念表示为 coordination.k8s.io API 组中的 Lease 对象， 常用于类似节点心跳和组件级领导者选举等系统核心能力
-	config, err := buildConfig(kubeconfig)
+	sources, err := parseClusterSources(kubeconfig, kubeContexts)
 	if err != nil {
 		klog.Fatal(err)
 	}
-	client := clientset.NewForConfigOrDie(config)
-
-	run := func(_ context.Context) {
-		// 在这里完成你的控制器循环
-		klog.Info("Controller loop...")
+	// clusters 中的 clientset 可在收到 SIGHUP 后被替换，用于凭证轮换的场景
+	clusters, err := newClusterSet(sources, leaseCluster, float32(kubeAPIQPS), kubeAPIBurst, startupRetryTimeout)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	klog.InfoS("kubernetes client rate limits", "qps", kubeAPIQPS, "burst", kubeAPIBurst)
+	// 租约锁和事件都位于 home 集群
+	client := clusters.Home()
+	// home 在每次请求时获取租约锁所在集群当前的 clientset，长期持有客户端的锁、租约和事件使用它，重新加载 kubeconfig 后随之更新
+	home := homeClient{clusters: clusters}
+	leaseV1, err := checkServerVersion(client.Discovery(), requiredServerVersion)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if lockType == lockTypeLease && !leaseV1 && (enableLeaderElection || observeOnly) {
+		// 旧集群不提供 v1 的 Lease，退回到 ConfigMap 锁；租约注解和领导者优先级依赖 Lease，无法退回
+		if len(leaseAnnotations) > 0 || leaderPriority != 0 {
+			klog.Fatal("API Server 不提供 coordination.k8s.io/v1 的 Lease，无法使用 lease-annotations 和 leader-priority")
+		}
+		klog.Warningf("API Server 不提供 coordination.k8s.io/v1 的 Lease，改用 %s 锁", lockTypeConfigMap)
+		lockType = lockTypeConfigMap
+	}
 
-		select {}
+	shutdownTracing, err := setupTracing(context.Background(), otelEndpoint, id)
+	if err != nil {
+		klog.Fatalf("初始化链路追踪失败: %v", err)
 	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			klog.ErrorS(err, "failed to flush traces")
+		}
+	}()
 
 	// 创建一个可取消(context.WithCancel)的Go context，用于通知选举代码何时适当放弃领导者位置
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// 注册一个用于监听中断信号(SIGTERM)的Go例程，一旦接收到中断信号，就取消Context并退出程序。
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	// 控制器循环使用的 context，收到终止信号或失去领导权时取消，使控制器停止接收新任务并排空工作队列
+	runCtx, stopRun := context.WithCancel(context.Background())
+	defer stopRun()
+	// running 用于等待控制器循环退出，保证在释放租约之前处理中的任务已经完成
+	var running sync.WaitGroup
+
+	// terminating 表示已经收到终止信号，此后失去领导权属于正常退出
+	var terminating atomic.Bool
+	// lostLeadership 表示在未收到终止信号的情况下失去了领导权
+	var lostLeadership atomic.Bool
+	// controllerFailed 表示控制器循环因错误退出（例如 --require-crd 时被监听的资源不存在）
+	var controllerFailed atomic.Bool
+	// leading 表示当前实例是否持有领导权
+	var leading atomic.Bool
+	// terminatedAt 记录收到终止信号的时间，用于统计领导权交接耗时
+	var terminatedAt atomic.Pointer[time.Time]
+	// stepdownRequests 接收 /stepdown 的请求，由领导者在任期内处理，容量为 1 使重复的请求返回 409
+	stepdownRequests := make(chan struct{}, 1)
+
+	// 注册一个用于监听终止信号（--shutdown-signals，默认 SIGTERM 和 SIGINT）的Go例程，一旦接收到终止信号，先停止控制器循环并等待其退出，再取消Context释放租约。
+	// 滚动更新时新的副本无需等待 LeaseDuration 过期即可接管，尽量缩短没有领导者的时间。
+	// 优雅退出期间再次收到终止信号时立即退出，用于中止卡住的退出流程，可以通过 --disable-force-exit 关闭。
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, signals...)
 	go func() {
-		<-ch
-		klog.Info("接收到终止信号")
+		sig := <-ch
+		klog.InfoS("received termination signal, starting graceful shutdown", "signal", sig.String(), "forceExitOnSecondSignal", !disableForceExit)
+		if !disableForceExit {
+			go func() {
+				sig := <-ch
+				klog.ErrorS(nil, "received second termination signal, forcing exit", "signal", sig.String())
+				klog.Flush()
+				os.Exit(1)
+			}()
+		}
+		now := time.Now()
+		terminatedAt.Store(&now)
+		terminating.Store(true)
+		if leading.Load() {
+			klog.InfoS("stopping reconcile loop and releasing lease", "id", id)
+		}
+		stopRun()
+		running.Wait()
+		klog.InfoS("reconcile loop stopped", "elapsed", time.Since(now))
 		cancel()
 	}()
 
-	// 定义一个租约锁对象(LeaseLock)。这个租约锁将在Kubernetes集群中用于进行领导者选举。
-	lock := &resourcelock.LeaseLock{
-		LeaseMeta: metav1.ObjectMeta{
-			Name:      leaseLockName,
-			Namespace: leaseLockNamespace,
-		},
-		Client: client.CoordinationV1(),
-		LockConfig: resourcelock.ResourceLockConfig{
-			Identity: id,
-		},
+	reloadOnSIGHUP(ctx, clusters.reload)
+
+	// 就绪标志，控制器初始化完成、可以参与选举时置为 true。
+	// 非领导者同样是就绪的（随时可以接管），是否为领导者通过 controller_leader_election_status 指标区分。
+	var ready atomic.Bool
+	// activeController 为已经创建的控制器，控制器运行后 informer 缓存完成初始同步之前不报告就绪，避免基于不完整的数据工作
+	var activeController atomic.Pointer[Controller]
+	isReady := func() bool {
+		if c := activeController.Load(); c != nil && (c.Syncing() || !c.WatchHealthy()) {
+			return false
+		}
+		return ready.Load()
+	}
+	// electionHealth 在领导者超过 LeaseDuration + leaderElectionHealthzTolerance 仍未成功续约时使 /healthz 失败，
+	// 由 kubelet 重启卡住的领导者；非领导者和未开启选举时始终健康
+	if leaderElectionHealthzTolerance == 0 {
+		leaderElectionHealthzTolerance = leaseDuration
+	}
+	electionHealth := leaderelection.NewLeaderHealthzAdaptor(leaderElectionHealthzTolerance)
+	// leaders 记录最近观察到的领导者，通过指标服务的 /leaders 接口查看
+	leaders := newLeaderHistory(leaderHistorySize)
+	// 以下 HTTP 服务在所有副本上运行，与是否持有领导权无关；
+	// 只有 reconcile 循环（以及 webhook）在 OnStartedLeading 中启动，仅在领导者上运行。
+	// servers 记录所有 HTTP 服务的关闭信号，退出前等待它们关闭完成
+	// 每个服务使用独立的 context，退出时按顺序关闭：webhook 随控制器循环最先关闭，使 API Server 尽快切换到其他副本；
+	// 然后关闭指标和性能分析服务，让处理中的抓取请求完成；健康检查服务最后关闭，避免排空期间存活探针失败。
+	var metricsErr error
+	metrics := startServer(func(ctx context.Context) <-chan struct{} {
+		var stepdown http.Handler
+		if adminToken != "" {
+			stepdown = stepdownHandler(adminToken, leading.Load, stepdownRequests)
+		}
+		done, err := startMetricsServer(ctx, metricsAddr, enablePprof && pprofAddr == "", leaders, stepdown, metricsTLSOptions{
+			certFile:     metricsTLSCert,
+			keyFile:      metricsTLSKey,
+			clientCAFile: metricsClientCA,
+		})
+		if err != nil {
+			metricsErr = err
+			closed := make(chan struct{})
+			close(closed)
+			return closed
+		}
+		return done
+	})
+	if metricsErr != nil {
+		klog.Fatal(metricsErr)
+	}
+	servers := []runningServer{metrics}
+	if enablePprof && pprofAddr != "" {
+		servers = append(servers, startServer(func(ctx context.Context) <-chan struct{} {
+			return startPprofServer(ctx, pprofAddr)
+		}))
+	}
+	servers = append(servers, startServer(func(ctx context.Context) <-chan struct{} {
+		return startHealthServer(ctx, healthAddr, isReady, electionHealth.Check)
+	}))
+	// 退出前按顺序关闭所有 HTTP 服务并等待关闭完成
+	defer func() {
+		cancel()
+		klog.Info("shutting down HTTP servers")
+		for _, s := range servers {
+			s.shutdown()
+		}
+	}()
+	leaderElectionStatus.WithLabelValues(id).Set(0)
+
+	// 记录最近一次观察到的领导者，用于判断领导者是否发生变更
+	var lastLeader string
+	// observeNewLeader 记录一次观察到的领导者，领导者发生变更时更新指标和 /leaders 历史
+	observeNewLeader := func(identity string) {
+		logV(componentLeaderElection, 4).InfoS("observed leader", "identity", identity, "previous", lastLeader)
+		if identity == lastLeader {
+			return
+		}
+		if lastLeader != "" {
+			leaderTransitions.WithLabelValues(id).Inc()
+		}
+		lastLeader = identity
+		leaders.record(identity, time.Now())
+	}
+
+	if observeOnly {
+		// 观察者模式下不参与选举，也不需要控制器相关的权限
+		ready.Store(true)
+		err := observeLeader(ctx, lockType, leaseLockName, leaseLockNamespace, client, func(identity string) {
+			observeNewLeader(identity)
+			klog.InfoS("new leader observed", "identity", identity)
+		})
+		if err != nil {
+			klog.ErrorS(err, "failed to observe leader")
+			return 1
+		}
+		return 0
+	}
+
+	// 领导权变更事件记录在锁对象上（Redis 锁记录在控制器所在的 Pod 上），便于通过 kubectl get events 查看
+	recorder, broadcaster := newEventRecorder(home, eventDedupWindow)
+	defer broadcaster.Shutdown()
+	lockRef := lockObjectReference(lockType, leaseLockName, leaseLockNamespace)
+	// lockEvents 记录 lockRef 上的事件，没有可以记录事件的对象时丢弃这些事件。
+	// Redis 锁的 lockRef 位于 Pod 的命名空间，可能与 --lease-lock-namespace 不同，recorder 的 sink 不限定命名空间
+	var lockEvents record.EventRecorder = recorder
+	if lockRef == nil {
+		klog.InfoS("controller pod unknown, leader election events will not be recorded", "lockType", lockType)
+		lockEvents = discardRecorder{}
+	}
+
+	if dryRun {
+		klog.Info("dry-run 模式：所有写操作只记录日志而不实际执行")
+	}
+	writeAccess.configure(writeForbiddenThreshold, func(err error) {
+		lockEvents.Eventf(lockRef, corev1.EventTypeWarning, eventReasonWriteAccessLost, "degraded: write access lost: %v", err)
+	})
+	reconciler, err := newReconciler(reconcilerName, clusters, dynamicResource, dryRun)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if !skipRBACCheck {
+		perms := make(map[string][]authorizationv1.ResourceAttributes, len(clusters.names))
+		for _, cluster := range clusters.names {
+			perms[cluster] = watchPermissions(reconciler, watchNamespace)
+			if !dynamicResource.Empty() {
+				// 默认的 Pod 权限由被监听资源的权限取代，Reconciler 自己声明的权限仍需检查
+				perms[cluster] = resourcePermissions(watchNamespace, dynamicResource.Group, dynamicResource.Resource, "list", "watch")
+				if p, ok := reconciler.(PermissionProvider); ok {
+					perms[cluster] = append(perms[cluster], p.RequiredPermissions(watchNamespace)...)
+				}
+			}
+			if !childStatusResource.Empty() {
+				perms[cluster] = append(perms[cluster], resourcePermissions(watchNamespace, childStatusResource.Group, childStatusResource.Resource, "list", "watch")...)
+			}
+			if namespaceSelector != nil {
+				perms[cluster] = append(perms[cluster], resourcePermissions("", "", "namespaces", "list", "watch")...)
+			}
+		}
+		// ReconcileFailed 事件只记录在主集群的对象上
+		perms[clusters.home] = append(perms[clusters.home], reconcileEventPermissions(watchNamespace)...)
+		if enableLeaderElection {
+			perms[clusters.home] = append(perms[clusters.home], leaderElectionPermissions(lockType, leaseLockNamespace)...)
+			if lockType == lockTypeRedis && lockRef != nil {
+				perms[clusters.home] = append(perms[clusters.home], resourcePermissions(lockRef.Namespace, "", "events", "create")...)
+			}
+			if createLeaseNamespace {
+				perms[clusters.home] = append(perms[clusters.home], resourcePermissions("", "", "namespaces", "get", "create")...)
+			}
+			if leaderLogConfigMap != "" {
+				perms[clusters.home] = append(perms[clusters.home], resourcePermissions(leaseLockNamespace, "", "configmaps", "get", "create", "update")...)
+			}
+		}
+		if err := preflightRBAC(ctx, clusters, perms); err != nil {
+			klog.Fatal(err)
+		}
+		klog.Info("RBAC 权限预检查通过")
+	}
+
+	if enableLeaderElection && createLeaseNamespace {
+		if err := ensureNamespace(ctx, client, leaseLockNamespace); err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	// ownedShards 记录分片模式下当前实例持有的分片，控制器只处理属于这些分片的 key
+	ownedShards := newShardSet(shardCount)
+	var shardFilter func(key string) bool
+	if shardCount > 1 {
+		shardFilter = ownedShards.owns
+	}
+	// retainedLock 不为 nil 时，Reconciler 多次 panic 后停止写入锁对象，使租约保留到自然过期
+	var retainedLock *retainableLock
+	var onPanic func(key string)
+	if disableLeaseReleaseOnPanic {
+		onPanic = newPanicGuard(panicThreshold, func(panics int) {
+			klog.ErrorS(nil, "RECONCILER PANICKED REPEATEDLY: stopping the controller and retaining the lease until it expires, investigate the objects it was writing before another replica takes over",
+				"id", id, "panics", panics, "leaseDuration", leaseDuration)
+			controllerUnhealthy.Set(1)
+			lockEvents.Eventf(lockRef, corev1.EventTypeWarning, eventReasonLeaseRetained, "%s stopped after %d reconciler panics, retaining the lease until it expires", id, panics)
+			retainedLock.retain()
+			stopRun()
+		}).observe
+	}
+	var eventPredicates []Predicate
+	if generationChangedOnly {
+		eventPredicates = append(eventPredicates, GenerationChangedPredicate)
+	}
+	// 显式指定了监听的命名空间时以 --watch-namespace 为准，即使它在排除列表中
+	var excludedNamespaces []string
+	if watchNamespace == "" {
+		excludedNamespaces = splitList(excludeNamespaces)
+	}
+	// 分片模式下控制器循环在所有实例上持续运行，不随领导权启停，因此稳定期只作用于标准的领导者选举
+	var stablePeriod time.Duration
+	if enableLeaderElection && shardCount == 1 {
+		stablePeriod = leaderStablePeriod
+	}
+	// 手动让出领导权后控制器的工作队列和 informer 已经关闭，重新参与选举前使用相同的配置重新创建控制器
+	controllerOpts := ControllerOptions{
+		Namespace:                  watchNamespace,
+		NamespaceSelector:          namespaceSelector,
+		LabelSelector:              objectLabelSelector,
+		FieldSelector:              objectFieldSelector,
+		DynamicResource:            dynamicResource,
+		ChildStatusResource:        childStatusResource,
+		CacheSyncTimeout:           cacheSyncTimeout,
+		ShardFilter:                shardFilter,
+		WatchErrorThreshold:        watchErrorThreshold,
+		WatchErrorWindow:           watchErrorWindow,
+		InformerMaxErrorDuration:   informerMaxErrorDuration,
+		ResyncPeriod:               resyncPeriod,
+		FullSyncPeriod:             fullSyncPeriod,
+		InformerStartupConcurrency: informerStartupConcurrency,
+		RequireResource:            requireCRD,
+		ReconcileTimeout:           reconcileTimeout,
+		ShutdownTimeout:            shutdownTimeout,
+		MaxRetries:                 maxReconcileRetries,
+		DisableCacheReads:          !readFromCache,
+		OnPanic:                    onPanic,
+		ReconcileDebounce:          reconcileDebounce,
+		Predicates:                 eventPredicates,
+		StablePeriod:               stablePeriod,
+		ExcludeNamespaces:          excludedNamespaces,
+		MaxConcurrentPerNamespace:  maxConcurrentPerNamespace,
+	}
+	controller, err := NewController(clusters, recorder, reconciler, controllerOpts)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	activeController.Store(controller)
+	run := func(ctx context.Context) {
+		running.Add(1)
+		defer running.Done()
+
+		// 在这里完成你的控制器循环
+		klog.Info("Controller loop...")
+
+		// webhook 与控制器循环使用同一个 context，因此只有领导者提供服务，失去领导权时随之关闭
+		if enableWebhook && !runOnce {
+			var defaulter Defaulter
+			if enableMutatingWebhook {
+				defaulter = defaulterFor(reconciler)
+			}
+			webhookDone := startWebhookServer(ctx, webhookAddr, tlsCertFile, tlsKeyFile, validatorFor(reconciler), defaulter)
+			defer func() { <-webhookDone }()
+		}
+
+		if writeForbiddenThreshold > 0 {
+			// 权限恢复后只读期间被跳过的写操作需要重新执行，因此将所有对象重新入队
+			go watchWriteAccess(ctx, clusters, reconciler, watchNamespace, writeAccessCheckInterval, func() {
+				lockEvents.Event(lockRef, corev1.EventTypeNormal, eventReasonWriteAccessRestored, "write access restored")
+				controller.requeueAll()
+			})
+		}
+
+		if runOnce {
+			// 单次模式下完成一轮 reconcile 后退出进程，同时结束选举以释放租约
+			if err := controller.RunOnce(ctx); err != nil {
+				klog.ErrorS(err, "run-once pass failed")
+				controllerFailed.Store(true)
+			}
+			terminating.Store(true)
+			cancel()
+			return
+		}
+
+		if err := controller.Run(ctx, workers); err != nil {
+			klog.ErrorS(err, "controller stopped with error")
+			// 控制器无法继续工作时退出进程，同时结束选举以释放租约
+			controllerFailed.Store(true)
+			cancel()
+		}
+	}
+
+	if !enableLeaderElection {
+		// 单副本部署不需要领导者选举，直接运行控制器循环直到收到终止信号
+		klog.Info("leader election disabled, running controller directly")
+		ready.Store(true)
+		run(runCtx)
+		if controllerFailed.Load() {
+			return 1
+		}
+		return 0
+	}
+
+	if !sleepJitter(ctx, startupJitter) {
+		// 等待期间收到终止信号，尚未参与选举，直接退出
+		return 0
+	}
+
+	if shardCount > 1 {
+		// 分片模式下控制器循环在所有实例上运行，informer 缓存始终保持最新，只处理当前实例持有的分片中的 key。
+		// 收到终止信号时先停止控制器循环，再取消 ctx 释放所有分片的租约。
+		klog.InfoS("sharded leader election", "id", id, "shardCount", shardCount, "shards", assignedShards)
+		ready.Store(true)
+		go run(runCtx)
+		err := runShardElections(ctx, assignedShards, shardElectionConfig{
+			id:              id,
+			leaseDuration:   leaseDuration,
+			renewDeadline:   renewDeadline,
+			retryPeriod:     retryPeriod,
+			releaseOnCancel: releaseOnCancel,
+			newLock: func(shard int) (resourcelock.Interface, error) {
+				return newLeaderLock(lockType, shardLeaseName(leaseLockName, shard), leaseLockNamespace, id, home, leaseAnnotations)
+			},
+			onAcquired: func(shard int) {
+				ownedShards.set(shard, true)
+				// 获得分片之前属于该分片的对象都被过滤掉了，需要重新入队
+				controller.requeueAll()
+			},
+			onLost: func(shard int) {
+				ownedShards.set(shard, false)
+			},
+		})
+		if err != nil {
+			klog.ErrorS(err, "failed to start sharded leader election")
+			return 1
+		}
+		stopRun()
+		running.Wait()
+		if controllerFailed.Load() {
+			return 1
+		}
+		return 0
+	}
+
+	// wasLeader 表示当前实例是否曾经持有领导权，用于退出前确认租约已经释放
+	var wasLeader atomic.Bool
+	// preempted 表示当前实例因为优先级更高的候选者而主动让出了领导权，此后退出属于正常退出
+	var preempted atomic.Bool
+	// steppingDown 表示当前任期因 /stepdown 的请求而结束，选举结束后释放租约并重新参与选举
+	var steppingDown atomic.Bool
+	// endTerm 结束当前这一轮选举，每轮选举开始前设置
+	var endTerm context.CancelFunc
+	// 抢占只支持 lease 锁，优先级记录在租约的注解中
+	// transitionLog 不为 nil 时将领导权变更记录持久化到 ConfigMap
+	var transitionLog *leaderLog
+	if leaderLogConfigMap != "" {
+		transitionLog = newLeaderLog(home, leaseLockNamespace, leaderLogConfigMap, leaderLogSize)
+	}
+	preemptionEnabled := lockType == lockTypeLease
+	// stepDown 在发现优先级更高的候选者时调用：先停止控制器循环，再将租约直接交给 candidate 并结束选举。
+	// 交接后租约已不再由当前实例持有，退出时释放租约的请求会因冲突而失败，这是预期的行为。
+	// 当前实例随后退出，由 Deployment 重新拉起后作为普通候选者参与选举。
+	stepDown := func(candidate string) {
+		klog.InfoS("stepping down for higher-priority candidate", "id", id, "candidate", candidate, "priority", leaderPriority)
+		preempted.Store(true)
+		lockEvents.Eventf(lockRef, corev1.EventTypeNormal, eventReasonPreempted, "%s stepped down for higher-priority candidate %s", id, candidate)
+		stopRun()
+		running.Wait()
+		handOffCtx, cancelHandOff := context.WithTimeout(context.Background(), renewDeadline)
+		defer cancelHandOff()
+		if err := handOffLease(handOffCtx, home, leaseLockNamespace, leaseLockName, id, candidate); err != nil {
+			klog.ErrorS(err, "failed to hand off lease, releasing it instead", "candidate", candidate)
+		}
+		cancel()
+	}
+	// manualStepdown 处理 /stepdown 的请求：先通过 stopLeading 停止控制器循环并等待其退出，再结束本轮选举。
+	// 与抢占不同，当前实例不会退出，释放租约并等待其他副本接管后重新参与选举。
+	manualStepdown := func(stopLeading context.CancelFunc) {
+		klog.InfoS("stepping down on administrator request", "id", id)
+		steppingDown.Store(true)
+		lockEvents.Eventf(lockRef, corev1.EventTypeNormal, eventReasonManualStepdown, "%s stepped down on administrator request", id)
+		stopLeading()
+		running.Wait()
+		endTerm()
+	}
+
+	// 选举使用的 context。设置了 leader-election-timeout 时，如果超时前仍未成为领导者则取消选举；
+	// 成为领导者之后超时不再生效，因此这里不能直接使用 context.WithTimeout。
+	electionCtx, cancelElection := context.WithCancel(ctx)
+	defer cancelElection()
+	var electionTimer *time.Timer
+	if leaderElectionTimeout > 0 {
+		electionTimer = time.AfterFunc(leaderElectionTimeout, func() {
+			if leading.Load() {
+				return
+			}
+			klog.InfoS("leader election timed out, giving up", "id", id, "timeout", leaderElectionTimeout)
+			cancelElection()
+		})
+	}
+
+	// 定义一个资源锁对象，默认为租约锁(LeaseLock)。这个资源锁将在Kubernetes集群中用于进行领导者选举。
+	lock, err := newLeaderLock(lockType, leaseLockName, leaseLockNamespace, id, home, leaseAnnotations)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	lock = timedLock{lock}
+	if disableLeaseReleaseOnPanic {
+		retainedLock = &retainableLock{Interface: lock}
+		lock = retainedLock
+	}
+	// 锁的实现会缓存最近读到的对象，不能与选举并发使用，因此检查锁对象时使用独立的实例
+	checkLock, err := newResourceLock(lockType, leaseLockName, leaseLockNamespace, id, home)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	transitionsLock, err := newResourceLock(lockType, leaseLockName, leaseLockNamespace, id, home)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	// 所有副本都从锁对象读取领导权变更次数，刚启动的副本也能报告完整的计数
+	transitions := newLeaseTransitions(transitionsLock)
+	if leaseTransitionsInterval > 0 {
+		go transitions.poll(electionCtx, leaseTransitionsInterval)
+	}
+
+	// 获取领导权的过程单独记录为一个 span，在成为领导者或选举结束时结束
+	_, acquireSpan := tracer().Start(electionCtx, "leader-election.acquire", trace.WithAttributes(attribute.String("id", id)))
+	var endAcquireSpan sync.Once
+	defer endAcquireSpan.Do(func() { acquireSpan.End() })
+
+	// 非领导者也报告就绪，使滚动更新可以继续进行；reconcile 循环仍然只在获得领导权后启动
+	ready.Store(true)
+
+	if preemptionEnabled && leaderPriority > 0 {
+		go requestPreemption(electionCtx, home, leaseLockNamespace, leaseLockName, id, leaderPriority, retryPeriod, leading.Load)
 	}
 
 	// 运行领导者选举。LeaderElectionConfig中定义了如何获取和释放锁，以及一旦自身获得或丢失领导权时应该执行的操作。如果领导者身份改变，也会通过回调函数通知。
-	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+	electionConfig := leaderelection.LeaderElectionConfig{
 		Lock: lock,
 		// IMPORTANT: you MUST ensure that any code you have that
 		// is protected by the lease must terminate **before**
@@ -105,29 +1074,141 @@ func main() {
 		// loop still running and another process could
 		// get elected before your background loop finished, violating
 		// the stated goal of the lease.
-		ReleaseOnCancel: true,
-		LeaseDuration:   60 * time.Second,
-		RenewDeadline:   15 * time.Second,
-		RetryPeriod:     5 * time.Second,
+		ReleaseOnCancel: releaseOnCancel,
+		WatchDog:        electionHealth,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
 		Callbacks: leaderelection.LeaderCallbacks{
 			OnStartedLeading: func(ctx context.Context) {
 				// we're notified when we start - this is where you would
 				// usually put your code
+				// 上一个任期内未处理的 /stepdown 请求不再有效
+				select {
+				case <-stepdownRequests:
+				default:
+				}
+				leading.Store(true)
+				wasLeader.Store(true)
+				endAcquireSpan.Do(func() { acquireSpan.End() })
+				if electionTimer != nil {
+					electionTimer.Stop()
+				}
+				klog.InfoS("started leading", "id", id)
+				lockEvents.Eventf(lockRef, corev1.EventTypeNormal, eventReasonBecameLeader, "%s became leader", id)
+				leaderElectionStatus.WithLabelValues(id).Set(1)
+				if preemptionEnabled {
+					if err := publishLeaderPriority(ctx, home, leaseLockNamespace, leaseLockName, id, leaderPriority); err != nil {
+						klog.ErrorS(err, "failed to publish leader priority")
+					}
+					go func() {
+						if candidate := watchPreemption(ctx, home, leaseLockNamespace, leaseLockName, id, leaderPriority, retryPeriod); candidate != "" {
+							stepDown(candidate)
+						}
+					}()
+				}
+				if lockCheckInterval > 0 {
+					go checkLockHealth(ctx, checkLock, id, lockCheckInterval, leaseDuration, func(message string) {
+						klog.Warning(message)
+						lockEvents.Event(lockRef, corev1.EventTypeWarning, eventReasonLockAnomaly, message)
+					})
+				}
+				ctx, cancelRun := context.WithCancel(ctx)
+				defer cancelRun()
+				go func() {
+					select {
+					case <-stepdownRequests:
+						manualStepdown(cancelRun)
+					case <-ctx.Done():
+					}
+				}()
+				stop := context.AfterFunc(runCtx, cancelRun)
+				defer stop()
 				run(ctx)
 			},
 			OnStoppedLeading: func() {
 				// we can do cleanup here
-				klog.Infof("leader lost: %s", id)
-				os.Exit(0)
+				// 选举结束时总会调用该回调，包括从未获得领导权的情况（例如等待超时或收到终止信号）
+				if leading.Swap(false) {
+					lockEvents.Eventf(lockRef, corev1.EventTypeNormal, eventReasonLostLeadership, "%s lost leadership", id)
+					leaderElectionStatus.WithLabelValues(id).Set(0)
+					klog.InfoS("leader lost", "id", id)
+					if !terminating.Load() && !preempted.Load() && !steppingDown.Load() {
+						lostLeadership.Store(true)
+					}
+				}
+				if !steppingDown.Load() {
+					stopRun()
+				}
 			},
 			OnNewLeader: func(identity string) {
 				// we're notified when new leader elected
+				observeNewLeader(identity)
+				transitions.update(ctx)
 				if identity == id {
 					// I just got the lock
+					if transitionLog != nil {
+						if err := transitionLog.record(ctx, id, time.Now()); err != nil {
+							klog.ErrorS(err, "failed to record leader transition", "configmap", leaderLogConfigMap)
+						}
+					}
 					return
 				}
-				klog.Infof("new leader elected: %s", identity)
+				klog.InfoS("new leader elected", "identity", identity)
 			},
 		},
-	})
+	}
+	for {
+		var termCtx context.Context
+		termCtx, endTerm = context.WithCancel(electionCtx)
+		leaderelection.RunOrDie(termCtx, electionConfig)
+		endTerm()
+		if !steppingDown.Swap(false) {
+			break
+		}
+		// 手动让出领导权后控制器已经停止，释放租约并等待其他副本接管，然后以新的控制器参与下一轮选举
+		if !releaseAfterStepdown(electionCtx, lock, id, leaseDuration, retryPeriod) {
+			break
+		}
+		controller, err = NewController(clusters, recorder, reconciler, controllerOpts)
+		if err != nil {
+			klog.ErrorS(err, "failed to recreate controller after stepdown")
+			return 1
+		}
+		activeController.Store(controller)
+	}
+
+	// 选举结束后等待控制器循环退出，然后返回退出码
+	stopRun()
+	running.Wait()
+	if retainedLock != nil {
+		if since, ok := retainedLock.retainedSince(); ok {
+			// 停止续约后租约最多在 LeaseDuration 后过期，等到过期后再退出，期间不会有其他副本获得领导权
+			if remaining := time.Until(since.Add(leaseDuration)); remaining > 0 {
+				klog.InfoS("waiting for retained lease to expire", "id", id, "remaining", remaining)
+				time.Sleep(remaining)
+			}
+			klog.ErrorS(nil, "exiting after reconciler panics, lease expired without being released", "id", id)
+			return 1
+		}
+	}
+	if wasLeader.Load() && releaseOnCancel {
+		if verifyLockReleased(lock, id, releaseVerifyTimeout) {
+			klog.InfoS("lease released", "lock", lock.Describe(), "id", id)
+			// 交接耗时为收到终止信号到租约释放的时间，未主动释放时新的领导者最多需要等待 LeaseDuration
+			if t := terminatedAt.Load(); t != nil {
+				klog.InfoS("lease handed off", "id", id, "latency", time.Since(*t), "leaseDuration", leaseDuration)
+			}
+		} else {
+			klog.Warningf("租约 %s 在 %s 后仍然显示 %s 为持有者，租约可能没有正确释放", lock.Describe(), releaseVerifyTimeout, id)
+		}
+	}
+	if lostLeadership.Load() {
+		klog.ErrorS(nil, "leadership lost unexpectedly", "id", id)
+		return 1
+	}
+	if controllerFailed.Load() {
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// leaderElectionStatus 表示当前实例是否为领导者，1 为领导者，0 为非领导者
+	leaderElectionStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "controller_leader_election_status",
+		Help: "当前实例是否为领导者（1 为领导者，0 为非领导者）",
+	}, []string{"id"})
+
+	// leaderTransitions 统计当前实例观察到的领导者变更次数
+	leaderTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "controller_leader_transitions_total",
+		Help: "当前实例观察到的领导者变更次数",
+	}, []string{"id"})
+
+	// leaseRenewDuration 统计领导者每次续约写入锁对象的耗时，id 为持有者身份，result 为 success 或 error
+	leaseRenewDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "controller_lease_renew_duration_seconds",
+		Help:    "领导者每次续约写入锁对象的耗时",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"id", "result"})
+
+	// controllerWriteAccess 表示控制器当前是否拥有写权限，0 表示因连续的 Forbidden 错误进入了只读模式
+	controllerWriteAccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "controller_write_access",
+		Help: "控制器当前是否拥有写权限（1 为正常，0 为只读模式）",
+	})
+
+	// reconcileDuration 统计每次 reconcile 的耗时，result 为 success 或 error。开启追踪时附带 trace_id exemplar，用于从延迟尖峰跳转到对应的 trace
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "controller_reconcile_duration_seconds",
+		Help:    "每次 reconcile 的耗时",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"result"})
+
+	// reconcilePanics 统计 Reconciler 发生 panic 的次数，发生 panic 的 key 会按指数退避重试
+	reconcilePanics = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "controller_reconcile_panics_total",
+		Help: "Reconciler 发生 panic 的次数",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(leaderElectionStatus, leaderTransitions, leaseRenewDuration, controllerWriteAccess, reconcileDuration, reconcilePanics)
+}
+
+// observeWithTraceExemplar 函数记录 value，span 被采样时附带 trace_id exemplar；未开启追踪时 span 无效，只记录 value
+func observeWithTraceExemplar(o prometheus.Observer, span trace.SpanContext, value float64) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && span.IsSampled() {
+		eo.ObserveWithExemplar(value, prometheus.Labels{"trace_id": span.TraceID().String()})
+		return
+	}
+	o.Observe(value)
+}
+
+// metricsTLSOptions 是指标服务的 TLS 配置，certFile 和 keyFile 为空时使用 HTTP
+type metricsTLSOptions struct {
+	certFile string
+	keyFile  string
+	// clientCAFile 不为空时要求 Prometheus 提供由该 CA 签发的客户端证书
+	clientCAFile string
+}
+
+// startMetricsServer 函数启动一个 HTTP 服务，在 /metrics 路径上暴露 Prometheus 指标，并在 ctx 取消时关闭服务。返回的 channel 在服务关闭完成后关闭。
+// enablePprof 为 true 时同时在该服务上注册 /debug/pprof/* 接口。tlsOpts 指定了证书时改为提供 HTTPS 服务，证书文件更新后自动重新加载。
+func startMetricsServer(ctx context.Context, addr string, enablePprof bool, leaders *leaderHistory, stepdown http.Handler, tlsOpts metricsTLSOptions) (<-chan struct{}, error) {
+	mux := http.NewServeMux()
+	// exemplar 只能通过 OpenMetrics 格式输出，Prometheus 需要开启 exemplar-storage 才会抓取
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
+	mux.Handle("/leaders", leaders)
+	if stepdown != nil {
+		mux.Handle("/stepdown", stepdown)
+	}
+	if enablePprof {
+		registerPprof(mux)
+	}
+
+	if tlsOpts.certFile != "" {
+		return serveReloadingTLS(ctx, "metrics", addr, tlsOpts.certFile, tlsOpts.keyFile, tlsOpts.clientCAFile, mux)
+	}
+	return serveHTTP(ctx, "metrics", addr, mux), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+)
+
+// Defaulter 为准入请求中的对象填充默认值，直接修改 obj。返回错误时拒绝该请求。
+type Defaulter func(ctx context.Context, req *admissionv1.AdmissionRequest, obj *unstructured.Unstructured) error
+
+// AdmissionDefaulter 可以由 Reconciler 实现，用于为 /mutate 提供填充默认值的逻辑；未实现时不修改任何对象。
+type AdmissionDefaulter interface {
+	Default(ctx context.Context, req *admissionv1.AdmissionRequest, obj *unstructured.Unstructured) error
+}
+
+// defaulterFor 函数返回 reconciler 对应的 Defaulter。
+func defaulterFor(reconciler Reconciler) Defaulter {
+	if d, ok := reconciler.(AdmissionDefaulter); ok {
+		return d.Default
+	}
+	return func(context.Context, *admissionv1.AdmissionRequest, *unstructured.Unstructured) error {
+		return nil
+	}
+}
+
+// mutateHandler 函数返回处理 MutatingWebhook 的 AdmissionReview 的 http.Handler：
+// 对 CREATE 和 UPDATE 请求调用 defaulter，并以 JSON Patch 的形式返回修改前后对象的差异。
+func mutateHandler(defaulter Defaulter) http.Handler {
+	return admissionHandler(func(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+		resp := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+		if len(req.Object.Raw) == 0 {
+			// DELETE 等请求没有需要填充默认值的对象
+			return resp
+		}
+
+		var original map[string]interface{}
+		if err := json.Unmarshal(req.Object.Raw, &original); err != nil {
+			return deniedResponse(req, http.StatusBadRequest, metav1.StatusReasonBadRequest, fmt.Errorf("解码对象失败: %w", err))
+		}
+		obj := &unstructured.Unstructured{Object: runtime.DeepCopyJSON(original)}
+		if err := defaulter(ctx, req, obj); err != nil {
+			klog.InfoS("admission defaulting failed", "kind", req.Kind.Kind, "namespace", req.Namespace, "name", req.Name, "err", err)
+			return deniedResponse(req, http.StatusInternalServerError, metav1.StatusReasonInternalError, err)
+		}
+
+		// Defaulter 写入的整数等类型与解码得到的 float64 不同，重新编解码后再比较，避免产生多余的 replace 操作
+		encoded, err := json.Marshal(obj.Object)
+		if err != nil {
+			return deniedResponse(req, http.StatusInternalServerError, metav1.StatusReasonInternalError, err)
+		}
+		var mutated map[string]interface{}
+		if err := json.Unmarshal(encoded, &mutated); err != nil {
+			return deniedResponse(req, http.StatusInternalServerError, metav1.StatusReasonInternalError, err)
+		}
+		ops := jsonPatch("", original, mutated, nil)
+		if len(ops) == 0 {
+			return resp
+		}
+		// Patch 是 JSON Patch 的原始字节，序列化 AdmissionReview 时 encoding/json 会将 []byte 编码为 base64，不能再手动编码
+		patch, err := json.Marshal(ops)
+		if err != nil {
+			return deniedResponse(req, http.StatusInternalServerError, metav1.StatusReasonInternalError, err)
+		}
+		klog.V(4).InfoS("admission request mutated", "kind", req.Kind.Kind, "namespace", req.Namespace, "name", req.Name, "operations", len(ops))
+		patchType := admissionv1.PatchTypeJSONPatch
+		resp.Patch = patch
+		resp.PatchType = &patchType
+		return resp
+	})
+}
+
+// jsonPatchOperation 是 RFC 6902 JSON Patch 中的一个操作
+type jsonPatchOperation struct {
+	Op    string
+	Path  string
+	Value interface{}
+}
+
+// MarshalJSON 实现 json.Marshaler。remove 操作没有 value，add 和 replace 即使 value 为 null 也必须输出。
+func (o jsonPatchOperation) MarshalJSON() ([]byte, error) {
+	if o.Op == "remove" {
+		return json.Marshal(map[string]interface{}{"op": o.Op, "path": o.Path})
+	}
+	return json.Marshal(map[string]interface{}{"op": o.Op, "path": o.Path, "value": o.Value})
+}
+
+// jsonPatch 函数返回将 before 修改为 after 的 JSON Patch 操作，追加到 ops 之后。
+// 对象逐个字段比较，数组和其他类型的值不同时整体替换。
+func jsonPatch(path string, before, after interface{}, ops []jsonPatchOperation) []jsonPatchOperation {
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if !beforeIsMap || !afterIsMap {
+		if !reflect.DeepEqual(before, after) {
+			ops = append(ops, jsonPatchOperation{Op: "replace", Path: path, Value: after})
+		}
+		return ops
+	}
+
+	keys := make([]string, 0, len(beforeMap)+len(afterMap))
+	for key := range beforeMap {
+		keys = append(keys, key)
+	}
+	for key := range afterMap {
+		if _, ok := beforeMap[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		child := path + "/" + escapeJSONPointer(key)
+		oldValue, inBefore := beforeMap[key]
+		newValue, inAfter := afterMap[key]
+		switch {
+		case !inAfter:
+			ops = append(ops, jsonPatchOperation{Op: "remove", Path: child})
+		case !inBefore:
+			ops = append(ops, jsonPatchOperation{Op: "add", Path: child, Value: newValue})
+		default:
+			ops = jsonPatch(child, oldValue, newValue, ops)
+		}
+	}
+	return ops
+}
+
+// escapeJSONPointer 函数按 RFC 6901 转义 JSON Pointer 中的 ~ 和 /
+func escapeJSONPointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
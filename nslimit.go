@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// namespaceThrottleDelay 是所属命名空间的并发已满时 key 重新入队的延迟
+const namespaceThrottleDelay = 200 * time.Millisecond
+
+// namespaceLimiter 是按命名空间计数的信号量，限制同一个命名空间中同时处理的 key 数量，
+// 避免一个命名空间中大量变化的对象占满所有 worker，使其他命名空间的对象长时间得不到处理。
+type namespaceLimiter struct {
+	max int
+
+	mu     sync.Mutex
+	active map[string]int
+}
+
+// newNamespaceLimiter 函数创建一个每个命名空间最多允许 max 个并发的 namespaceLimiter，max 不大于 0 时返回 nil 表示不限制
+func newNamespaceLimiter(max int) *namespaceLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &namespaceLimiter{max: max, active: map[string]int{}}
+}
+
+// tryAcquire 函数在 namespace 的并发数未达到上限时占用一个名额并返回 true，否则返回 false
+func (l *namespaceLimiter) tryAcquire(namespace string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[namespace] >= l.max {
+		return false
+	}
+	l.active[namespace]++
+	return true
+}
+
+// release 函数释放 tryAcquire 占用的名额
+func (l *namespaceLimiter) release(namespace string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[namespace] <= 1 {
+		delete(l.active, namespace)
+		return
+	}
+	l.active[namespace]--
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+// observeLeader 函数通过 informer 监听锁对象，每当持有者发生变化时调用 onNewLeader，阻塞直到 ctx 取消。
+// 与 leaderelection 不同，它只读取锁对象而不参与选举，适用于只需要知道当前领导者的 sidecar 或监控程序。
+func observeLeader(ctx context.Context, lockType, name, namespace string, client clientset.Interface, onNewLeader func(identity string)) error {
+	if lockType == lockTypeRedis {
+		return observeRedisLeader(ctx, name, namespace, onNewLeader)
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}),
+	)
+	defer factory.Shutdown()
+
+	var informer cache.SharedIndexInformer
+	switch lockType {
+	case lockTypeLease:
+		informer = factory.Coordination().V1().Leases().Informer()
+	case lockTypeConfigMap:
+		informer = factory.Core().V1().ConfigMaps().Informer()
+	case lockTypeEndpoints:
+		informer = factory.Core().V1().Endpoints().Informer()
+	default:
+		return fmt.Errorf("未知的锁类型 %q，可选值为 %s、%s、%s、%s", lockType, lockTypeLease, lockTypeConfigMap, lockTypeEndpoints, lockTypeRedis)
+	}
+
+	// 事件处理函数按顺序调用，因此 last 不需要加锁
+	var last string
+	observe := func(obj interface{}) {
+		identity, err := lockHolder(obj)
+		if err != nil {
+			klog.ErrorS(err, "failed to decode leader election record", "lock", namespace+"/"+name)
+			return
+		}
+		if identity == "" || identity == last {
+			return
+		}
+		last = identity
+		onNewLeader(identity)
+	}
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: observe,
+		UpdateFunc: func(_, newObj interface{}) {
+			observe(newObj)
+		},
+	}); err != nil {
+		return fmt.Errorf("注册锁对象事件处理函数失败: %w", err)
+	}
+
+	klog.InfoS("observing leader election without participating", "lock", namespace+"/"+name, "type", lockType)
+	factory.Start(ctx.Done())
+	<-ctx.Done()
+	return nil
+}
+
+// lockHolder 函数返回锁对象当前的持有者，没有持有者时返回空字符串。
+func lockHolder(obj interface{}) (string, error) {
+	switch o := obj.(type) {
+	case *coordinationv1.Lease:
+		if o.Spec.HolderIdentity == nil {
+			return "", nil
+		}
+		return *o.Spec.HolderIdentity, nil
+	case *corev1.ConfigMap:
+		record, _, err := decodeLeaderRecord(o.Annotations)
+		if err != nil {
+			return "", err
+		}
+		return record.HolderIdentity, nil
+	case *corev1.Endpoints:
+		record, _, err := decodeLeaderRecord(o.Annotations)
+		if err != nil {
+			return "", err
+		}
+		return record.HolderIdentity, nil
+	default:
+		return "", fmt.Errorf("未知的锁对象类型 %T", obj)
+	}
+}
+
+// redisObservePeriod 是观察者模式下轮询 Redis 锁的间隔
+const redisObservePeriod = 2 * time.Second
+
+// observeRedisLeader 函数在观察者模式下轮询 Redis 锁，Redis 不支持 watch，因此持有者的变化最多延迟 redisObservePeriod 被发现
+func observeRedisLeader(ctx context.Context, name, namespace string, onNewLeader func(identity string)) error {
+	lock, err := newRedisLock(name, namespace, resourcelock.ResourceLockConfig{})
+	if err != nil {
+		return err
+	}
+	klog.InfoS("observing leader election without participating", "lock", lock.Describe(), "type", lockTypeRedis)
+	var last string
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		record, _, err := lock.Get(ctx)
+		if apierrors.IsNotFound(err) {
+			return
+		}
+		if err != nil {
+			logV(componentLeaderElection, 2).InfoS("failed to read redis lock", "lock", lock.Describe(), "err", err)
+			return
+		}
+		if record.HolderIdentity == "" || record.HolderIdentity == last {
+			return
+		}
+		last = record.HolderIdentity
+		onNewLeader(last)
+	}, redisObservePeriod)
+	return nil
+}
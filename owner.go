@@ -0,0 +1,22 @@
+package main
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// setOwnerReference 函数将 parent 设置为 child 的控制者（Controller 和 BlockOwnerDeletion 均为 true），
+// 使 parent 被删除时 Kubernetes 垃圾回收自动清理 child。gvk 为 parent 的类型，从 API 读取的对象通常不带 TypeMeta，因此需要显式传入。
+// child 已经带有指向 parent 的 OwnerReference 时将其替换，其他 OwnerReference 保持不变。
+func setOwnerReference(child, parent metav1.Object, gvk schema.GroupVersionKind) {
+	ref := *metav1.NewControllerRef(parent, gvk)
+	refs := child.GetOwnerReferences()
+	for i := range refs {
+		if refs[i].UID == ref.UID {
+			refs[i] = ref
+			child.SetOwnerReferences(refs)
+			return
+		}
+	}
+	child.SetOwnerReferences(append(refs, ref))
+}
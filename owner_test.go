@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetOwnerReference(t *testing.T) {
+	gvk := appsv1.SchemeGroupVersion.WithKind("Deployment")
+	parent := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "web-uid"}}
+	other := metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: "other", UID: "other-uid"}
+	child := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		OwnerReferences: []metav1.OwnerReference{other, {APIVersion: "apps/v1", Kind: "Deployment", Name: "old-name", UID: "web-uid"}},
+	}}
+
+	setOwnerReference(child, parent, gvk)
+	setOwnerReference(child, parent, gvk)
+
+	refs := child.GetOwnerReferences()
+	if len(refs) != 2 {
+		t.Fatalf("got %d owner references, want 2: %+v", len(refs), refs)
+	}
+	if refs[0] != other {
+		t.Errorf("unrelated owner reference changed: %+v", refs[0])
+	}
+	ref := refs[1]
+	if ref.APIVersion != "apps/v1" || ref.Kind != "Deployment" || ref.Name != "web" || ref.UID != "web-uid" {
+		t.Errorf("owner reference = %+v, want apps/v1 Deployment web (web-uid)", ref)
+	}
+	if ref.Controller == nil || !*ref.Controller {
+		t.Error("owner reference Controller is not true")
+	}
+	if ref.BlockOwnerDeletion == nil || !*ref.BlockOwnerDeletion {
+		t.Error("owner reference BlockOwnerDeletion is not true")
+	}
+}
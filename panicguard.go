@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// controllerUnhealthy 表示控制器是否因为 Reconciler 多次 panic 而停止工作并保留了租约
+var controllerUnhealthy = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "controller_unhealthy",
+	Help: "控制器是否因为 Reconciler 多次 panic 而停止工作并保留租约（1 为是，0 为否）",
+})
+
+func init() {
+	prometheus.MustRegister(controllerUnhealthy)
+}
+
+// errLeaseRetained 是锁被保留后写入锁对象时返回的错误
+var errLeaseRetained = errors.New("Reconciler 多次 panic，租约被保留到自然过期，不再续约或释放")
+
+// retainableLock 包装一个资源锁，调用 retain 之后拒绝所有写入：领导者不再续约，退出时也不释放租约，
+// 其他副本只能在租约自然过期后获得领导权。
+type retainableLock struct {
+	resourcelock.Interface
+	retainedAt atomic.Pointer[time.Time]
+}
+
+// retain 函数停止写入锁对象，只有第一次调用生效
+func (l *retainableLock) retain() {
+	now := time.Now()
+	l.retainedAt.CompareAndSwap(nil, &now)
+}
+
+// retainedSince 函数返回锁被保留的时间，未被保留时返回 false
+func (l *retainableLock) retainedSince() (time.Time, bool) {
+	if t := l.retainedAt.Load(); t != nil {
+		return *t, true
+	}
+	return time.Time{}, false
+}
+
+// Create 创建锁对象，锁被保留后返回 errLeaseRetained
+func (l *retainableLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	if _, ok := l.retainedSince(); ok {
+		return errLeaseRetained
+	}
+	return l.Interface.Create(ctx, ler)
+}
+
+// Update 更新锁对象，锁被保留后返回 errLeaseRetained
+func (l *retainableLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	if _, ok := l.retainedSince(); ok {
+		return errLeaseRetained
+	}
+	return l.Interface.Update(ctx, ler)
+}
+
+// panicGuard 统计 Reconciler 发生 panic 的次数，达到 threshold 次时调用一次 trip
+type panicGuard struct {
+	threshold int
+	trip      func(panics int)
+
+	count atomic.Int32
+	once  sync.Once
+}
+
+// newPanicGuard 函数创建一个 panic 次数达到 threshold 时调用 trip 的 panicGuard
+func newPanicGuard(threshold int, trip func(panics int)) *panicGuard {
+	return &panicGuard{threshold: threshold, trip: trip}
+}
+
+// observe 函数记录一次 panic，可以作为 ControllerOptions.OnPanic 使用
+func (g *panicGuard) observe(string) {
+	if n := int(g.count.Add(1)); n >= g.threshold {
+		g.once.Do(func() { g.trip(n) })
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+)
+
+// registerPprof 函数在 mux 上注册 /debug/pprof/* 性能分析接口。
+// 这些接口会暴露进程内部信息，只应在需要排查问题时开启，并通过 NetworkPolicy 限制访问。
+func registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// startPprofServer 函数在独立的地址上启动性能分析服务，并在 ctx 取消时关闭服务。返回的 channel 在服务关闭完成后关闭。
+func startPprofServer(ctx context.Context, addr string) <-chan struct{} {
+	mux := http.NewServeMux()
+	registerPprof(mux)
+
+	return serveHTTP(ctx, "pprof", addr, mux)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Predicate 在 informer 事件入队之前过滤不需要处理的事件，返回 false 的事件不会入队。字段为 nil 时该类事件全部入队。
+// 删除事件的对象可能是 cache.DeletedFinalStateUnknown。
+type Predicate struct {
+	CreateFunc func(obj interface{}) bool
+	UpdateFunc func(oldObj, newObj interface{}) bool
+	DeleteFunc func(obj interface{}) bool
+}
+
+// GenerationChangedPredicate 只保留 metadata.generation 发生变化的更新事件，忽略只修改 status 或 metadata 的更新，
+// 避免控制器自己写入 status 后再次触发 reconcile。新增和删除事件不受影响。
+// informer 的定期 resync 产生的更新事件 generation 不变，同样会被过滤；全量同步直接入队，不受影响。
+// 不填写 generation 的资源（generation 始终为 0）的更新事件会全部被过滤。
+var GenerationChangedPredicate = Predicate{
+	UpdateFunc: func(oldObj, newObj interface{}) bool {
+		oldMeta, err := meta.Accessor(oldObj)
+		if err != nil {
+			return true
+		}
+		newMeta, err := meta.Accessor(newObj)
+		if err != nil {
+			return true
+		}
+		return oldMeta.GetGeneration() != newMeta.GetGeneration()
+	},
+}
+
+// StatusChangedPredicate 只保留 status 发生变化的更新事件，与 GenerationChangedPredicate 相反，
+// 忽略只修改 spec 或 metadata 的更新，用于监听子资源的状态变化（例如 Pod 变为 Ready）。新增和删除事件不受影响。
+// 无法取得 status 的对象的更新事件全部保留。
+var StatusChangedPredicate = Predicate{
+	UpdateFunc: func(oldObj, newObj interface{}) bool {
+		oldStatus, ok := objectStatus(oldObj)
+		if !ok {
+			return true
+		}
+		newStatus, ok := objectStatus(newObj)
+		if !ok {
+			return true
+		}
+		return !equality.Semantic.DeepEqual(oldStatus, newStatus)
+	},
+}
+
+// objectStatus 函数返回对象的 status 字段，类型化的对象先转换为 unstructured
+func objectStatus(obj interface{}) (interface{}, bool) {
+	switch o := obj.(type) {
+	case *unstructured.Unstructured:
+		return o.Object["status"], true
+	case runtime.Object:
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(o)
+		if err != nil {
+			return nil, false
+		}
+		return u["status"], true
+	default:
+		return nil, false
+	}
+}
+
+// predicates 是多个 Predicate 的组合，所有 Predicate 都返回 true 时事件才会入队
+type predicates []Predicate
+
+func (ps predicates) create(obj interface{}) bool {
+	for _, p := range ps {
+		if p.CreateFunc != nil && !p.CreateFunc(obj) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ps predicates) update(oldObj, newObj interface{}) bool {
+	for _, p := range ps {
+		if p.UpdateFunc != nil && !p.UpdateFunc(oldObj, newObj) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ps predicates) delete(obj interface{}) bool {
+	for _, p := range ps {
+		if p.DeleteFunc != nil && !p.DeleteFunc(obj) {
+			return false
+		}
+	}
+	return true
+}
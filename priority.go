@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/klog/v2"
+)
+
+// 领导者抢占使用的租约注解。领导者在 leaderPriorityAnnotation 中公布自己的优先级，
+// 优先级更高的候选者在 preemptPriorityAnnotation 和 preemptIdentityAnnotation 中请求抢占。
+const (
+	leaderPriorityAnnotation  = "first-controller.io/leader-priority"
+	preemptPriorityAnnotation = "first-controller.io/preempt-priority"
+	preemptIdentityAnnotation = "first-controller.io/preempt-identity"
+)
+
+// annotationPriority 函数解析注解中的优先级，注解不存在或无效时返回 0
+func annotationPriority(annotations map[string]string, key string) int {
+	p, err := strconv.Atoi(annotations[key])
+	if err != nil {
+		return 0
+	}
+	return p
+}
+
+// publishLeaderPriority 函数在成为领导者后将自己的优先级写入租约注解，并清除已经处理过的抢占请求。
+func publishLeaderPriority(ctx context.Context, leases coordinationv1client.LeasesGetter, namespace, name, id string, priority int) error {
+	lease, err := leases.Leases(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != id {
+		return nil
+	}
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[leaderPriorityAnnotation] = strconv.Itoa(priority)
+	if lease.Annotations[preemptIdentityAnnotation] == id {
+		delete(lease.Annotations, preemptPriorityAnnotation)
+		delete(lease.Annotations, preemptIdentityAnnotation)
+	}
+	_, err = leases.Leases(namespace).Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+// requestPreemption 函数在未持有领导权时每隔 period 检查一次租约：当前领导者的优先级低于 priority 时，
+// 在租约注解中请求抢占。已经有优先级不低于 priority 的抢占请求时不做任何操作，优先级相同时不会抢占，避免领导权来回切换。
+func requestPreemption(ctx context.Context, leases coordinationv1client.LeasesGetter, namespace, name, id string, priority int, period time.Duration, leading func() bool) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if leading() {
+			return
+		}
+		lease, err := leases.Leases(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			logV(componentLeaderElection, 2).InfoS("failed to get lease for preemption", "err", err)
+			return
+		}
+		holder := ""
+		if lease.Spec.HolderIdentity != nil {
+			holder = *lease.Spec.HolderIdentity
+		}
+		if holder == "" || holder == id {
+			return
+		}
+		if annotationPriority(lease.Annotations, leaderPriorityAnnotation) >= priority {
+			return
+		}
+		if lease.Annotations[preemptIdentityAnnotation] != "" && annotationPriority(lease.Annotations, preemptPriorityAnnotation) >= priority {
+			return
+		}
+
+		if lease.Annotations == nil {
+			lease.Annotations = map[string]string{}
+		}
+		lease.Annotations[preemptPriorityAnnotation] = strconv.Itoa(priority)
+		lease.Annotations[preemptIdentityAnnotation] = id
+		if _, err := leases.Leases(namespace).Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+			logV(componentLeaderElection, 2).InfoS("failed to request preemption", "err", err)
+			return
+		}
+		klog.InfoS("requested leader preemption", "leader", holder, "id", id, "priority", priority)
+	}, period)
+}
+
+// watchPreemption 函数在持有领导权期间每隔 period 检查一次租约，发现优先级高于 priority 的抢占请求时返回该候选者的身份，
+// ctx 取消时返回空字符串。
+func watchPreemption(ctx context.Context, leases coordinationv1client.LeasesGetter, namespace, name, id string, priority int, period time.Duration) string {
+	var candidate string
+	_ = wait.PollUntilContextCancel(ctx, period, false, func(ctx context.Context) (bool, error) {
+		lease, err := leases.Leases(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			logV(componentLeaderElection, 2).InfoS("failed to get lease while watching for preemption", "err", err)
+			return false, nil
+		}
+		requester := lease.Annotations[preemptIdentityAnnotation]
+		if requester == "" || requester == id || annotationPriority(lease.Annotations, preemptPriorityAnnotation) <= priority {
+			return false, nil
+		}
+		candidate = requester
+		return true, nil
+	})
+	return candidate
+}
+
+// handOffLease 函数将租约直接交给 candidate，使其在下一次重试时成为领导者，而不会被其他低优先级的候选者抢先获得。
+// 请求带有 resourceVersion，租约在此期间被修改时返回冲突错误。
+func handOffLease(ctx context.Context, leases coordinationv1client.LeasesGetter, namespace, name, id, candidate string) error {
+	lease, err := leases.Leases(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != id {
+		return nil
+	}
+
+	now := metav1.NewMicroTime(time.Now())
+	transitions := int32(0)
+	if lease.Spec.LeaseTransitions != nil {
+		transitions = *lease.Spec.LeaseTransitions
+	}
+	transitions++
+	lease.Spec = coordinationv1.LeaseSpec{
+		HolderIdentity:       &candidate,
+		LeaseDurationSeconds: lease.Spec.LeaseDurationSeconds,
+		AcquireTime:          &now,
+		RenewTime:            &now,
+		LeaseTransitions:     &transitions,
+	}
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[leaderPriorityAnnotation] = lease.Annotations[preemptPriorityAnnotation]
+	delete(lease.Annotations, preemptPriorityAnnotation)
+	delete(lease.Annotations, preemptIdentityAnnotation)
+	_, err = leases.Leases(namespace).Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
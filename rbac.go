@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// PermissionProvider 可以由 Reconciler 实现，声明其在 namespace 中需要的权限，用于启动时的 RBAC 预检查；
+// 未实现时认为只需要 list/watch Pod。
+type PermissionProvider interface {
+	RequiredPermissions(namespace string) []authorizationv1.ResourceAttributes
+}
+
+// resourcePermissions 函数为 group/resource 在 namespace 中的每个 verb 生成一条权限
+func resourcePermissions(namespace, group, resource string, verbs ...string) []authorizationv1.ResourceAttributes {
+	perms := make([]authorizationv1.ResourceAttributes, 0, len(verbs))
+	for _, verb := range verbs {
+		perms = append(perms, authorizationv1.ResourceAttributes{
+			Namespace: namespace,
+			Verb:      verb,
+			Group:     group,
+			Resource:  resource,
+		})
+	}
+	return perms
+}
+
+// leaderElectionPermissions 函数返回使用 lockType 类型的锁进行领导者选举所需的权限
+func leaderElectionPermissions(lockType, namespace string) []authorizationv1.ResourceAttributes {
+	group, resource := "coordination.k8s.io", "leases"
+	switch lockType {
+	case lockTypeConfigMap:
+		group, resource = "", "configmaps"
+	case lockTypeEndpoints:
+		group, resource = "", "endpoints"
+	case lockTypeRedis:
+		// Redis 锁不读写 Kubernetes 对象，领导权变更事件记录在控制器所在的 Pod 上，事件权限由调用方按 Pod 的命名空间检查
+		return nil
+	}
+	perms := resourcePermissions(namespace, group, resource, "get", "create", "update")
+	return append(perms, resourcePermissions(namespace, "", "events", "create")...)
+}
+
+// watchPermissions 函数返回 reconciler 在 namespace 中需要的权限
+func watchPermissions(reconciler Reconciler, namespace string) []authorizationv1.ResourceAttributes {
+	if p, ok := reconciler.(PermissionProvider); ok {
+		return p.RequiredPermissions(namespace)
+	}
+	return resourcePermissions(namespace, "", "pods", "list", "watch")
+}
+
+// reconcileEventPermissions 函数返回在 namespace 中的被监听对象上记录 ReconcileFailed 事件所需的权限
+func reconcileEventPermissions(namespace string) []authorizationv1.ResourceAttributes {
+	return resourcePermissions(namespace, "", "events", "create")
+}
+
+// describePermission 函数返回权限的可读描述，例如 "update coordination.k8s.io/leases in kube-system"
+func describePermission(p authorizationv1.ResourceAttributes) string {
+	resource := p.Resource
+	if p.Group != "" {
+		resource = p.Group + "/" + p.Resource
+	}
+	if p.Subresource != "" {
+		resource += "/" + p.Subresource
+	}
+	scope := "all namespaces"
+	if p.Namespace != "" {
+		scope = p.Namespace
+	}
+	return fmt.Sprintf("%s %s in %s", p.Verb, resource, scope)
+}
+
+// checkPermissions 函数通过 SelfSubjectAccessReview 检查当前身份是否拥有 perms 中的所有权限，返回被拒绝的权限描述。
+func checkPermissions(ctx context.Context, client clientset.Interface, perms []authorizationv1.ResourceAttributes) ([]string, error) {
+	var denied []string
+	for i := range perms {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &perms[i],
+			},
+		}
+		resp, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("检查权限 %s 失败: %w", describePermission(perms[i]), err)
+		}
+		if !resp.Status.Allowed {
+			denied = append(denied, describePermission(perms[i]))
+		}
+	}
+	return denied, nil
+}
+
+// preflightRBAC 函数检查每个集群是否拥有所需的权限，存在被拒绝的权限时返回列出所有被拒绝权限的错误。
+func preflightRBAC(ctx context.Context, clusters *clusterSet, perms map[string][]authorizationv1.ResourceAttributes) error {
+	var problems []string
+	for _, cluster := range clusters.names {
+		denied, err := checkPermissions(ctx, clusters.Client(cluster), perms[cluster])
+		if err != nil {
+			return err
+		}
+		for _, d := range denied {
+			if cluster != "" {
+				d = cluster + ": " + d
+			}
+			problems = append(problems, d)
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("RBAC 权限不足，以下权限被拒绝：\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+// ReadyConditionReconciler 是一个面向 CRD 的示例 Reconciler：通过 --watch-gvr 监听任意资源，
+// 在每个对象的 status.conditions 中设置 Ready=True，并将 observedGeneration 设为对象当前的 generation。
+// 资源需要启用 status 子资源，status.conditions 的结构与 metav1.Condition 相同。
+type ReadyConditionReconciler struct {
+	clusters *clusterSet
+	resource schema.GroupVersionResource
+	// cache 为控制器的 informer 缓存，为 nil 时直接从 API Server 读取
+	cache ObjectCache
+	// dryRun 为 true 时只记录将要执行的 status 更新而不实际执行
+	dryRun bool
+}
+
+// NewReadyConditionReconciler 函数创建一个处理 resource 的 ReadyConditionReconciler，resource 为空时返回错误
+func NewReadyConditionReconciler(clusters *clusterSet, resource schema.GroupVersionResource, dryRun bool) (*ReadyConditionReconciler, error) {
+	if resource.Empty() {
+		return nil, fmt.Errorf("reconciler %s 需要通过 --watch-gvr 指定监听的资源", reconcilerReadyCondition)
+	}
+	return &ReadyConditionReconciler{clusters: clusters, resource: resource, dryRun: dryRun}, nil
+}
+
+// InjectCache 设置读取对象使用的 informer 缓存
+func (r *ReadyConditionReconciler) InjectCache(cache ObjectCache) {
+	r.cache = cache
+}
+
+// RequiredPermissions 返回 ReadyConditionReconciler 需要的权限
+func (r *ReadyConditionReconciler) RequiredPermissions(namespace string) []authorizationv1.ResourceAttributes {
+	perms := resourcePermissions(namespace, r.resource.Group, r.resource.Resource, "get", "list", "watch")
+	status := resourcePermissions(namespace, r.resource.Group, r.resource.Resource, "update")
+	for i := range status {
+		status[i].Subresource = "status"
+	}
+	return append(perms, status...)
+}
+
+// Reconcile 将 key 对应对象的 Ready condition 设置为 True
+func (r *ReadyConditionReconciler) Reconcile(ctx context.Context, key string) (Result, error) {
+	return Result{}, r.reconcile(ctx, key)
+}
+
+// reconcile 函数执行 Reconcile 的实际逻辑，condition 没有变化时不写入。
+// 对象被并发修改导致 status 更新冲突时重新从 API Server 读取最新的对象并重新设置 condition，而不是让整个 reconcile 失败后重试。
+func (r *ReadyConditionReconciler) reconcile(ctx context.Context, key string) error {
+	cluster, objectKey := splitClusterKey(key)
+	namespace, name, err := cache.SplitMetaNamespaceKey(objectKey)
+	if err != nil {
+		return err
+	}
+
+	resources := r.clusters.Dynamic(cluster).Resource(r.resource).Namespace(namespace)
+	live := func(ctx context.Context) (*unstructured.Unstructured, error) {
+		return resources.Get(ctx, name, metav1.GetOptions{})
+	}
+	attempt := 0
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		attempt++
+		var current *unstructured.Unstructured
+		var err error
+		if attempt == 1 {
+			current, err = cachedGetUnstructured(ctx, r.cache, cluster, namespace, name, live)
+		} else {
+			// 缓存可能还没有收到导致冲突的修改，重试时直接读取最新的对象
+			current, err = live(ctx)
+		}
+		if apierrors.IsNotFound(err) {
+			// 对象已被删除，无需处理
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return r.setReady(ctx, key, resources, current)
+	})
+}
+
+// setReady 函数在 current 上设置 Ready condition 并写入 status 子资源，current 可能来自缓存，不会被修改
+func (r *ReadyConditionReconciler) setReady(ctx context.Context, key string, resources dynamic.ResourceInterface, current *unstructured.Unstructured) error {
+	conditions, err := unstructuredConditions(current)
+	if err != nil {
+		return TerminalError(err)
+	}
+	changed := SetCondition(&conditions, metav1.Condition{
+		Type:               conditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Reconciled",
+		Message:            "对象已完成 reconcile",
+		ObservedGeneration: current.GetGeneration(),
+	})
+	if !changed {
+		return nil
+	}
+
+	// 缓存中的对象不能修改，因此在副本上写入
+	obj := current.DeepCopy()
+	if err := setUnstructuredConditions(obj, conditions); err != nil {
+		return err
+	}
+	klog.InfoS("setting ready condition", "key", key, "resource", r.resource.String(), "generation", obj.GetGeneration())
+	return guardedWrite(r.dryRun, "update status ready condition", key, current, func() (runtime.Object, error) {
+		return resources.UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+	})
+}
+
+// unstructuredConditions 函数读取对象的 status.conditions
+func unstructuredConditions(obj *unstructured.Unstructured) ([]metav1.Condition, error) {
+	raw, found, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil || !found {
+		return nil, err
+	}
+	var status struct {
+		Conditions []metav1.Condition `json:"conditions"`
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(map[string]interface{}{"conditions": raw}, &status); err != nil {
+		return nil, fmt.Errorf("解析 %s 的 status.conditions 失败: %w", obj.GetName(), err)
+	}
+	return status.Conditions, nil
+}
+
+// setUnstructuredConditions 函数将 conditions 写入对象的 status.conditions
+func setUnstructuredConditions(obj *unstructured.Unstructured, conditions []metav1.Condition) error {
+	raw := make([]interface{}, 0, len(conditions))
+	for i := range conditions {
+		cond, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&conditions[i])
+		if err != nil {
+			return err
+		}
+		raw = append(raw, cond)
+	}
+	return unstructured.SetNestedSlice(obj.Object, raw, "status", "conditions")
+}
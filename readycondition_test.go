@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var widgetsResource = schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+
+func TestReadyConditionReconcilerRetriesOnConflict(t *testing.T) {
+	widget := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata": map[string]interface{}{
+			"name":       "w",
+			"namespace":  "default",
+			"generation": int64(2),
+		},
+	}}
+	client := fakedynamic.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{widgetsResource: "WidgetList"}, widget)
+
+	// 第一次更新 status 时模拟其他客户端并发修改了对象，返回冲突
+	statusUpdates := 0
+	client.PrependReactor("update", "widgets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "status" {
+			return false, nil, nil
+		}
+		statusUpdates++
+		if statusUpdates > 1 {
+			return false, nil, nil
+		}
+		modified := widget.DeepCopy()
+		modified.SetLabels(map[string]string{"modified": "true"})
+		if err := client.Tracker().Update(widgetsResource, modified, "default"); err != nil {
+			t.Errorf("modify widget: %v", err)
+		}
+		return true, nil, apierrors.NewConflict(widgetsResource.GroupResource(), "w", nil)
+	})
+
+	clusters := newTestClusterSet(fake.NewSimpleClientset())
+	clusters.dynamicClients = map[string]dynamic.Interface{"": client}
+	r, err := NewReadyConditionReconciler(clusters, widgetsResource, false)
+	if err != nil {
+		t.Fatalf("NewReadyConditionReconciler() error = %v", err)
+	}
+
+	if _, err := r.Reconcile(context.Background(), "default/w"); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if statusUpdates != 2 {
+		t.Errorf("got %d status updates, want 2", statusUpdates)
+	}
+
+	got, err := client.Resource(widgetsResource).Namespace("default").Get(context.Background(), "w", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get widget: %v", err)
+	}
+	if got.GetLabels()["modified"] != "true" {
+		t.Error("retry did not re-fetch the latest object, concurrent modification was lost")
+	}
+	conditions, err := unstructuredConditions(got)
+	if err != nil {
+		t.Fatalf("decode conditions: %v", err)
+	}
+	ready := GetCondition(conditions, conditionReady)
+	if ready == nil {
+		t.Fatal("Ready condition not set")
+	}
+	if ready.Status != metav1.ConditionTrue || ready.ObservedGeneration != 2 {
+		t.Errorf("Ready condition = %+v, want status True and observedGeneration 2", *ready)
+	}
+}
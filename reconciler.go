@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// Reconciler 是控制器的扩展点，下游项目实现该接口即可接入自己的业务逻辑，而无需修改 Controller。
+// key 由 ControllerOptions.KeyFunc 生成，默认为 namespace/name 形式，多集群模式下带有集群前缀（可通过 splitClusterKey 拆分），
+// 返回错误时该 key 会按指数退避重新入队，返回的 Result 可以在成功时要求稍后再次处理。
+// ctx 中带有附加了 key 和 reconcileID 的 logger，可以通过 logr.FromContext(ctx) 取出。
+type Reconciler interface {
+	Reconcile(ctx context.Context, key string) (Result, error)
+}
+
+// Result 是一次 reconcile 的结果，零值表示处理完成、无需再次处理。返回错误时 Result 会被忽略。
+type Result struct {
+	// Requeue 为 true 时按指数退避将 key 重新入队，不视为失败
+	Requeue bool
+	// RequeueAfter 大于 0 时在经过该时间后重新处理 key，例如轮询外部状态时“30 秒后再检查”，优先于 Requeue
+	RequeueAfter time.Duration
+}
+
+// InformerProvider 可以由 Reconciler 实现，用于指定控制器监听的资源；未实现时控制器监听 Pod。
+// Resource 返回 Informer 所监听资源的 GroupVersionResource，用于在启动前确认该资源已经可用。
+type InformerProvider interface {
+	Informer(factory informers.SharedInformerFactory) cache.SharedIndexInformer
+	Resource() schema.GroupVersionResource
+}
+
+const (
+	reconcilerLogging          = "logging"
+	reconcilerDeploymentScaler = "deployment-scaler"
+	reconcilerSecretMirror     = "secret-mirror"
+	reconcilerConfigMapReload  = "configmap-reload"
+	reconcilerReadyCondition   = "ready-condition"
+	reconcilerScale            = "scale"
+)
+
+// newReconciler 函数根据名称创建内置的 Reconciler，未知的名称返回错误。resource 为通过 --watch-gvr 指定的监听资源，可以为空。
+func newReconciler(name string, clusters *clusterSet, resource schema.GroupVersionResource, dryRun bool) (Reconciler, error) {
+	switch name {
+	case reconcilerLogging:
+		return LoggingReconciler{}, nil
+	case reconcilerDeploymentScaler:
+		return NewDeploymentScaleReconciler(clusters, dryRun), nil
+	case reconcilerSecretMirror:
+		return NewSecretMirrorReconciler(clusters, dryRun), nil
+	case reconcilerConfigMapReload:
+		return NewConfigMapReloadReconciler(clusters, dryRun), nil
+	case reconcilerReadyCondition:
+		return NewReadyConditionReconciler(clusters, resource, dryRun)
+	case reconcilerScale:
+		return NewScaleReconciler(clusters, resource, dryRun)
+	default:
+		return nil, fmt.Errorf("未知的 reconciler %q，可选值为 %s、%s、%s、%s、%s、%s", name, reconcilerLogging, reconcilerDeploymentScaler, reconcilerSecretMirror, reconcilerConfigMapReload, reconcilerReadyCondition, reconcilerScale)
+	}
+}
+
+// terminalError 表示重试也无法成功的错误
+type terminalError struct {
+	err error
+}
+
+func (e *terminalError) Error() string { return e.err.Error() }
+func (e *terminalError) Unwrap() error { return e.err }
+
+// transientError 表示稍后重试可能成功的错误
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+// TerminalError 函数将 err 标记为终止性错误，例如对象的 spec 不合法。Reconcile 返回终止性错误时控制器不再重试该 key，
+// 只在对象上记录一个 Warning 事件，直到对象被修改后重新触发。err 为 nil 时返回 nil。
+func TerminalError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &terminalError{err: err}
+}
+
+// TransientError 函数将 err 标记为暂时性错误，例如 API Server 暂时不可用，控制器按指数退避重试。
+// 未标记的错误默认按暂时性错误处理，该函数用于显式说明或覆盖内层的终止性标记。err 为 nil 时返回 nil。
+func TransientError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transientError{err: err}
+}
+
+// IsTerminalError 函数返回 err 是否为终止性错误。错误链中最外层的标记生效，TransientError 可以覆盖内层的 TerminalError。
+func IsTerminalError(err error) bool {
+	for err != nil {
+		switch err.(type) {
+		case *terminalError:
+			return true
+		case *transientError:
+			return false
+		}
+		err = errors.Unwrap(err)
+	}
+	return false
+}
+
+// LoggingReconciler 是默认的 Reconciler 实现，只记录收到的 key，不做任何修改
+type LoggingReconciler struct{}
+
+// Reconcile 记录 key 对应的集群、namespace 和 name
+func (LoggingReconciler) Reconcile(ctx context.Context, key string) (Result, error) {
+	cluster, objectKey := splitClusterKey(key)
+	namespace, name, err := cache.SplitMetaNamespaceKey(objectKey)
+	if err != nil {
+		return Result{}, err
+	}
+	// logger 已经带有 key
+	klog.FromContext(ctx).Info("reconcile", "cluster", cluster, "namespace", namespace, "name", name)
+	return Result{}, nil
+}
+
+// guardedWrite 函数执行一次对集群的写操作（create/update/delete 等），dryRun 为 true 时只记录日志并跳过。
+// 因写权限丢失进入只读模式时同样跳过写操作，权限恢复后控制器会重新处理所有对象。
+// before 为写入前的对象（创建时为 nil），write 返回写入后的对象（删除时为 nil），开启审计日志时用于记录写入前后的差异。
+// Reconciler 中的所有写操作都必须通过该函数执行。
+func guardedWrite(dryRun bool, verb, key string, before runtime.Object, write func() (runtime.Object, error)) error {
+	if dryRun {
+		klog.InfoS("dry-run: would "+verb, "key", key)
+		return nil
+	}
+	if writeAccess.degraded() {
+		logV(componentReconcile, 2).InfoS("read-only: skipping "+verb, "key", key)
+		return nil
+	}
+	after, err := write()
+	writeAccess.observe(err)
+	if err == nil && auditLog != nil {
+		auditLog.record(verb, key, before, after)
+	}
+	return err
+}
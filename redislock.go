@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// lockTypeRedis 表示将选举记录保存在外部 Redis 中，使不共享 API Server 的多个集群也能协调领导权
+const lockTypeRedis = "redis"
+
+// redisCommandTimeout 是 ctx 没有截止时间时单条 Redis 命令的超时时间
+const redisCommandTimeout = 5 * time.Second
+
+// redisLockAddr 为 Redis 锁连接的地址（host:port），由 realMain 根据 --redis-addr 设置；密码从 REDIS_PASSWORD 环境变量读取
+var (
+	redisLockAddr     string
+	redisLockPassword string
+)
+
+// redisCompareAndSet 在键的当前值等于 ARGV[1] 时写入 ARGV[2] 并设置 ARGV[3] 毫秒的过期时间，否则返回 0
+const redisCompareAndSet = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3]) else return 0 end`
+
+// redisLockResource 用于在键不存在时构造 NotFound 错误，使 leaderelection 调用 Create
+var redisLockResource = schema.GroupResource{Group: "redis", Resource: "locks"}
+
+// RedisLock 将领导者选举记录以 JSON 保存在 Redis 的 Key 中。
+// Create 使用 SET NX PX 保证只有一个实例能创建记录，Update 使用 Lua 脚本比较并写入，只有看到的记录未被其他实例修改时才能续约。
+// 每次写入都将过期时间设置为租约时长，持有者崩溃后键自动过期，其他实例随即通过 Create 获取领导权。
+// 续约由 leaderelection 的续约循环定期调用 Update 完成；与 Redis 的连接断开时 Update 失败，
+// 超过 renew-deadline 仍未续约成功即视为失去领导权，与 API Server 不可用时的行为一致。
+type RedisLock struct {
+	Key        string
+	Client     *redisClient
+	LockConfig resourcelock.ResourceLockConfig
+	// raw 为最近一次读到或写入的选举记录，Update 以它作为比较的旧值
+	raw []byte
+}
+
+// newRedisLock 函数创建一个连接 redisLockAddr、以 namespace/name 为键的 RedisLock
+func newRedisLock(name, namespace string, lockConfig resourcelock.ResourceLockConfig) (*RedisLock, error) {
+	if redisLockAddr == "" {
+		return nil, fmt.Errorf("使用 %s 锁时必须指定 --redis-addr", lockTypeRedis)
+	}
+	return &RedisLock{
+		Key:        "first-controller/leader-election/" + namespace + "/" + name,
+		Client:     &redisClient{addr: redisLockAddr, password: redisLockPassword},
+		LockConfig: lockConfig,
+	}, nil
+}
+
+// Get 返回选举记录，键不存在时返回 NotFound 错误
+func (rl *RedisLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	reply, err := rl.Client.do(ctx, "GET", rl.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reply == nil {
+		return nil, nil, apierrors.NewNotFound(redisLockResource, rl.Key)
+	}
+	raw, ok := reply.([]byte)
+	if !ok {
+		return nil, nil, fmt.Errorf("Redis GET %s 返回了意外的结果 %v", rl.Key, reply)
+	}
+	var record resourcelock.LeaderElectionRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return nil, nil, err
+	}
+	rl.raw = raw
+	return &record, raw, nil
+}
+
+// Create 尝试创建一个领导者选举记录，键已存在时返回错误
+func (rl *RedisLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	raw, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+	reply, err := rl.Client.do(ctx, "SET", rl.Key, string(raw), "NX", "PX", redisTTL(ler))
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		return fmt.Errorf("Redis 锁 %s 已被其他实例创建", rl.Describe())
+	}
+	rl.raw = raw
+	return nil
+}
+
+// Update 在记录未被其他实例修改时更新领导者选举记录并重置过期时间
+func (rl *RedisLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	if rl.raw == nil {
+		return errors.New("redis lock not initialized, call get or create first")
+	}
+	raw, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+	reply, err := rl.Client.do(ctx, "EVAL", redisCompareAndSet, "1", rl.Key, string(rl.raw), string(raw), redisTTL(ler))
+	if err != nil {
+		return err
+	}
+	if reply == int64(0) {
+		return fmt.Errorf("Redis 锁 %s 已被其他实例修改或已过期", rl.Describe())
+	}
+	rl.raw = raw
+	return nil
+}
+
+// redisTTL 函数返回写入 ler 时键的过期时间（毫秒），至少为 1 秒
+func redisTTL(ler resourcelock.LeaderElectionRecord) string {
+	seconds := ler.LeaseDurationSeconds
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds * 1000)
+}
+
+// RecordEvent 只输出日志，Redis 锁没有可以记录事件的 Kubernetes 对象
+func (rl *RedisLock) RecordEvent(s string) {
+	logV(componentLeaderElection, 2).InfoS("redis lock event", "lock", rl.Describe(), "identity", rl.LockConfig.Identity, "event", s)
+}
+
+// Describe 返回锁的描述信息
+func (rl *RedisLock) Describe() string {
+	return fmt.Sprintf("redis://%s/%s", rl.Client.addr, rl.Key)
+}
+
+// Identity 返回锁的持有者身份
+func (rl *RedisLock) Identity() string {
+	return rl.LockConfig.Identity
+}
+
+// redisError 是 Redis 返回的错误回复
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisClient 是一个只支持 RESP2 请求-响应的最小 Redis 客户端，使用单个连接并串行执行命令。
+// 发生网络错误后关闭连接，下一条命令重新建立连接。
+type redisClient struct {
+	addr     string
+	password string
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// do 函数执行一条命令并返回回复：简单字符串为 string，整数为 int64，批量字符串为 []byte，数组为 []interface{}，空回复为 nil
+func (c *redisClient) do(ctx context.Context, args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisCommandTimeout)
+	}
+	if c.conn == nil {
+		if err := c.connect(ctx, deadline); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.roundTrip(deadline, args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		c.close()
+	}
+	return reply, err
+}
+
+// connect 函数建立连接，设置了密码时发送 AUTH
+func (c *redisClient) connect(ctx context.Context, deadline time.Time) error {
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("连接 Redis %s 失败: %w", c.addr, err)
+	}
+	c.conn, c.r = conn, bufio.NewReader(conn)
+	if c.password != "" {
+		if _, err := c.roundTrip(deadline, []string{"AUTH", c.password}); err != nil {
+			c.close()
+			return fmt.Errorf("Redis %s 认证失败: %w", c.addr, err)
+		}
+	}
+	return nil
+}
+
+func (c *redisClient) close() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	c.conn, c.r = nil, nil
+}
+
+func (c *redisClient) roundTrip(deadline time.Time, args []string) (interface{}, error) {
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readRedisReply(c.r)
+}
+
+// readRedisReply 函数读取一个 RESP2 回复
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("无效的 Redis 回复 %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readRedisReply(r); err != nil {
+				var replyErr redisError
+				if !errors.As(err, &replyErr) {
+					return nil, err
+				}
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("无效的 Redis 回复 %q", line)
+	}
+}
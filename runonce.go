@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"k8s.io/klog/v2"
+)
+
+// RunOnce 函数启动 informer 并等待缓存同步，然后依次 reconcile 缓存中的每个对象一次，完成后停止 informer 并返回，
+// 不运行持续的工作队列循环，用于以 Job 的形式执行一次性的修复或迁移。
+// 任一对象 reconcile 失败时返回错误；Reconcile 返回的 Result 中的重新入队要求会被忽略。
+// ctx 取消时处理完当前对象后立即返回错误。
+func (c *Controller) RunOnce(ctx context.Context) error {
+	defer c.queue.ShutDown()
+
+	informerCtx, cancel := context.WithCancel(ctx)
+	stop, err := c.startInformers(informerCtx)
+	defer func() {
+		cancel()
+		if stop != nil {
+			stop()
+		}
+	}()
+	if err != nil || stop == nil {
+		return err
+	}
+
+	keys := c.cachedKeys()
+	klog.InfoS("run-once pass started", "objects", len(keys))
+	// 与 worker 相同，处理中的 reconcile 不随 ctx 取消
+	reconcileCtx := context.WithoutCancel(ctx)
+	failed := 0
+	for i, key := range keys {
+		if ctx.Err() != nil {
+			return fmt.Errorf("单次同步被中断，已处理 %d/%d 个对象", i, len(keys))
+		}
+		if err := c.reconcileOnce(reconcileCtx, key); err != nil {
+			failed++
+			klog.ErrorS(err, "reconcile failed", "key", key)
+			c.recordFailure(key, "reconcile failed: %v", err)
+		}
+	}
+	klog.InfoS("run-once pass finished", "objects", len(keys), "failed", failed)
+	if failed > 0 {
+		return fmt.Errorf("%d/%d 个对象 reconcile 失败", failed, len(keys))
+	}
+	return nil
+}
+
+// reconcileOnce 函数在 reconcileTimeout 限制内对 key 执行一次 reconcile
+func (c *Controller) reconcileOnce(ctx context.Context, key string) error {
+	if c.reconcileTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.reconcileTimeout)
+		defer cancel()
+	}
+	result, err := c.reconcile(ctx, key)
+	if err == nil && (result.Requeue || result.RequeueAfter > 0) {
+		logV(componentReconcile, 2).InfoS("run-once: ignoring requeue request", "key", key)
+	}
+	return err
+}
+
+// cachedKeys 函数返回所有集群缓存中对象的 key，按字典序排列使处理顺序稳定
+func (c *Controller) cachedKeys() []string {
+	var keys []string
+	for cluster, ci := range c.informers {
+		for _, informer := range ci.informers() {
+			for _, obj := range informer.GetStore().List() {
+				key, err := c.keyFunc(obj)
+				if err != nil {
+					klog.Errorf("计算对象 key 失败: %v", err)
+					continue
+				}
+				key = clusterKey(cluster, key)
+				if c.shardFilter != nil && !c.shardFilter(key) {
+					continue
+				}
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// scaleSubresource 是可扩缩容资源的 scale 子资源名称
+const scaleSubresource = "scale"
+
+// getScale 函数通过 dynamic client 读取 gvr 资源中 namespace/name 对象的 scale 子资源。
+// Deployment、StatefulSet 以及声明了 scale 子资源的 CRD 都返回 autoscaling/v1 的 Scale，因此可以统一处理。
+func getScale(ctx context.Context, client dynamic.Interface, gvr schema.GroupVersionResource, namespace, name string) (*autoscalingv1.Scale, error) {
+	u, err := client.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{}, scaleSubresource)
+	if err != nil {
+		return nil, err
+	}
+	var scale autoscalingv1.Scale
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &scale); err != nil {
+		return nil, fmt.Errorf("解析 %s %s/%s 的 scale 子资源失败: %w", gvr.Resource, namespace, name, err)
+	}
+	return &scale, nil
+}
+
+// setScaleReplicas 函数通过 merge patch 将 scale 子资源的 spec.replicas 修改为 replicas，返回修改后的 Scale。
+// 使用 patch 而不是 update，避免与同时修改该对象的其他控制器（例如 HPA）发生冲突。
+func setScaleReplicas(ctx context.Context, client dynamic.Interface, gvr schema.GroupVersionResource, namespace, name string, replicas int32) (*autoscalingv1.Scale, error) {
+	patch := []byte(fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas))
+	u, err := client.Resource(gvr).Namespace(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}, scaleSubresource)
+	if err != nil {
+		return nil, err
+	}
+	var scale autoscalingv1.Scale
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &scale); err != nil {
+		return nil, fmt.Errorf("解析 %s %s/%s 的 scale 子资源失败: %w", gvr.Resource, namespace, name, err)
+	}
+	return &scale, nil
+}
+
+// ScaleReconciler 监听 --scale-target-gvr 指定的资源，当对象带有 first-controller.io/desired-replicas 注解时，
+// 通过 scale 子资源将副本数修改为注解中的值。与只支持 Deployment 的 DeploymentScaleReconciler 不同，
+// 它可以统一处理 Deployment、StatefulSet 和任何声明了 scale 子资源的 CRD。
+type ScaleReconciler struct {
+	clusters *clusterSet
+	resource schema.GroupVersionResource
+	// cache 为控制器的 informer 缓存，为 nil 时直接从 API Server 读取
+	cache ObjectCache
+	// dryRun 为 true 时只记录将要执行的 patch 而不实际执行
+	dryRun bool
+}
+
+// NewScaleReconciler 函数创建一个通过 scale 子资源调整 resource 副本数的 ScaleReconciler，resource 为空时返回错误
+func NewScaleReconciler(clusters *clusterSet, resource schema.GroupVersionResource, dryRun bool) (*ScaleReconciler, error) {
+	if resource.Empty() {
+		return nil, fmt.Errorf("reconciler %s 需要通过 --scale-target-gvr 指定目标资源", reconcilerScale)
+	}
+	return &ScaleReconciler{clusters: clusters, resource: resource, dryRun: dryRun}, nil
+}
+
+// InjectCache 设置读取对象使用的 informer 缓存
+func (r *ScaleReconciler) InjectCache(cache ObjectCache) {
+	r.cache = cache
+}
+
+// RequiredPermissions 返回 ScaleReconciler 需要的权限
+func (r *ScaleReconciler) RequiredPermissions(namespace string) []authorizationv1.ResourceAttributes {
+	perms := resourcePermissions(namespace, r.resource.Group, r.resource.Resource, "get", "list", "watch")
+	scale := resourcePermissions(namespace, r.resource.Group, r.resource.Resource, "get", "patch")
+	for i := range scale {
+		scale[i].Subresource = scaleSubresource
+	}
+	return append(perms, scale...)
+}
+
+// Reconcile 将 key 对应对象的副本数调整为注解中的期望值
+func (r *ScaleReconciler) Reconcile(ctx context.Context, key string) (Result, error) {
+	return Result{}, r.reconcile(ctx, key)
+}
+
+// reconcile 函数执行 Reconcile 的实际逻辑，扩缩容只需要执行一次，因此从不要求重新入队
+func (r *ScaleReconciler) reconcile(ctx context.Context, key string) error {
+	cluster, objectKey := splitClusterKey(key)
+	namespace, name, err := cache.SplitMetaNamespaceKey(objectKey)
+	if err != nil {
+		return err
+	}
+
+	client := r.clusters.Dynamic(cluster)
+	obj, err := cachedGetUnstructured(ctx, r.cache, cluster, namespace, name, func(ctx context.Context) (*unstructured.Unstructured, error) {
+		return client.Resource(r.resource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	})
+	if apierrors.IsNotFound(err) {
+		// 对象已被删除，无需处理
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	value, ok := obj.GetAnnotations()[desiredReplicasAnnotation]
+	if !ok {
+		return nil
+	}
+	desired, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || desired < 0 {
+		// 注解的值不合法时重试也无法成功，等待注解被修改
+		return TerminalError(fmt.Errorf("注解 %s 的值 %q 不是合法的副本数", desiredReplicasAnnotation, value))
+	}
+
+	scale, err := getScale(ctx, client, r.resource, namespace, name)
+	if apierrors.IsNotFound(err) {
+		// 对象刚被删除，或者资源没有 scale 子资源
+		return TerminalError(fmt.Errorf("读取 %s 的 scale 子资源失败，资源 %s 可能没有声明 scale 子资源: %w", key, r.resource, err))
+	}
+	if err != nil {
+		return err
+	}
+	if int64(scale.Spec.Replicas) == desired {
+		return nil
+	}
+
+	klog.InfoS("scaling resource", "key", key, "resource", r.resource.String(), "from", scale.Spec.Replicas, "replicas", desired)
+	return guardedWrite(r.dryRun, "patch scale replicas", key, scale, func() (runtime.Object, error) {
+		return setScaleReplicas(ctx, client, r.resource, namespace, name, int32(desired))
+	})
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// mirrorToAnnotation 列出 Secret 需要复制到的命名空间，逗号分隔
+	mirrorToAnnotation = "first-controller.io/mirror-to"
+	// mirroredFromAnnotation 记录副本的源 Secret（namespace/name），带有该注解的 Secret 不会再被复制
+	mirroredFromAnnotation = "first-controller.io/mirrored-from"
+	// mirrorSourceUIDLabel 记录副本的源 Secret 的 UID，用于跨命名空间查找某个源 Secret 的所有副本
+	mirrorSourceUIDLabel = "first-controller.io/mirror-source-uid"
+)
+
+// SecretMirrorReconciler 监听带有 first-controller.io/mirror-to 注解的 Secret，将其复制到注解中列出的命名空间并保持同步。
+// OwnerReference 不能跨命名空间，因此源 Secret 上会添加 finalizer，在源 Secret 删除时先删除所有副本。
+// 从注解中移除的命名空间中的副本会被删除，ServiceAccount token 类型的 Secret 不会被复制。
+type SecretMirrorReconciler struct {
+	clusters *clusterSet
+	// cache 为控制器的 informer 缓存，为 nil 时直接从 API Server 读取
+	cache ObjectCache
+	// dryRun 为 true 时只记录将要执行的写操作而不实际执行
+	dryRun bool
+}
+
+// NewSecretMirrorReconciler 函数创建一个 SecretMirrorReconciler
+func NewSecretMirrorReconciler(clusters *clusterSet, dryRun bool) *SecretMirrorReconciler {
+	return &SecretMirrorReconciler{clusters: clusters, dryRun: dryRun}
+}
+
+// Informer 返回 Secret 的 informer，使控制器监听 Secret
+func (r *SecretMirrorReconciler) Informer(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+	return factory.Core().V1().Secrets().Informer()
+}
+
+// InjectCache 设置读取源 Secret 使用的 informer 缓存
+func (r *SecretMirrorReconciler) InjectCache(cache ObjectCache) {
+	r.cache = cache
+}
+
+// Resource 返回 Secret 的 GroupVersionResource
+func (r *SecretMirrorReconciler) Resource() schema.GroupVersionResource {
+	return corev1.SchemeGroupVersion.WithResource("secrets")
+}
+
+// RequiredPermissions 返回 SecretMirrorReconciler 需要的权限。副本可能位于任意命名空间，因此写权限需要覆盖所有命名空间。
+func (r *SecretMirrorReconciler) RequiredPermissions(namespace string) []authorizationv1.ResourceAttributes {
+	return append(resourcePermissions(namespace, "", "secrets", "get", "list", "watch", "patch"),
+		resourcePermissions(metav1.NamespaceAll, "", "secrets", "get", "list", "create", "update", "delete")...)
+}
+
+// Reconcile 将 key 对应的 Secret 复制到注解中列出的命名空间，并删除不再需要的副本
+func (r *SecretMirrorReconciler) Reconcile(ctx context.Context, key string) (Result, error) {
+	return Result{}, r.reconcile(ctx, key)
+}
+
+// reconcile 函数执行 Reconcile 的实际逻辑，源 Secret 的变化由 informer 事件触发，因此从不要求重新入队
+func (r *SecretMirrorReconciler) reconcile(ctx context.Context, key string) error {
+	cluster, objectKey := splitClusterKey(key)
+	namespace, name, err := cache.SplitMetaNamespaceKey(objectKey)
+	if err != nil {
+		return err
+	}
+
+	client := r.clusters.Client(cluster)
+	secrets := client.CoreV1().Secrets(namespace)
+	secret, err := cachedGet(ctx, r.cache, cluster, namespace, func(factory informers.SharedInformerFactory) (*corev1.Secret, error) {
+		return factory.Core().V1().Secrets().Lister().Secrets(namespace).Get(name)
+	}, func(ctx context.Context) (*corev1.Secret, error) {
+		return secrets.Get(ctx, name, metav1.GetOptions{})
+	})
+	if apierrors.IsNotFound(err) {
+		// 源 Secret 删除前 finalizer 已经清理了副本
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := secret.Annotations[mirroredFromAnnotation]; ok {
+		// 副本本身不再复制，避免循环
+		return nil
+	}
+	if secret.Type == corev1.SecretTypeServiceAccountToken {
+		return nil
+	}
+
+	value, mirrored := secret.Annotations[mirrorToAnnotation]
+	if !mirrored && !hasFinalizer(secret, controllerFinalizer) {
+		return nil
+	}
+
+	patch := func(ctx context.Context, data []byte) error {
+		return guardedWrite(r.dryRun, "patch secret finalizers", key, secret, func() (runtime.Object, error) {
+			return secrets.Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{})
+		})
+	}
+	cleanup := func(ctx context.Context) error {
+		return r.pruneCopies(ctx, client, key, secret, nil)
+	}
+
+	if !mirrored {
+		// 注解被移除：删除所有副本后移除 finalizer
+		if err := cleanup(ctx); err != nil {
+			return err
+		}
+		return removeFinalizer(ctx, secret, controllerFinalizer, patch)
+	}
+
+	deleting, err := handleFinalizer(ctx, secret, controllerFinalizer, patch, cleanup)
+	if deleting || err != nil {
+		return err
+	}
+
+	targets := sets.New[string]()
+	for _, target := range splitList(value) {
+		if target == namespace {
+			continue
+		}
+		targets.Insert(target)
+		if err := r.syncCopy(ctx, client, key, secret, target); err != nil {
+			return err
+		}
+	}
+	return r.pruneCopies(ctx, client, key, secret, targets)
+}
+
+// syncCopy 函数在 target 命名空间中创建或更新 secret 的副本。target 中已经存在同名但不是该 Secret 副本的对象时返回错误而不覆盖。
+func (r *SecretMirrorReconciler) syncCopy(ctx context.Context, client clientset.Interface, key string, secret *corev1.Secret, target string) error {
+	source := secret.Namespace + "/" + secret.Name
+	desired := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secret.Name,
+			Namespace: target,
+			Labels: map[string]string{
+				managedByLabel:       controllerName,
+				mirrorSourceUIDLabel: string(secret.UID),
+			},
+			Annotations: map[string]string{mirroredFromAnnotation: source},
+		},
+		Type: secret.Type,
+		Data: secret.Data,
+	}
+
+	copies := client.CoreV1().Secrets(target)
+	existing, err := copies.Get(ctx, secret.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		klog.InfoS("creating mirrored secret", "source", source, "namespace", target)
+		return guardedWrite(r.dryRun, "create mirrored secret in "+target, key, nil, func() (runtime.Object, error) {
+			return copies.Create(ctx, desired, metav1.CreateOptions{})
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	if existing.Annotations[mirroredFromAnnotation] != source {
+		return fmt.Errorf("命名空间 %s 中已存在不属于 %s 的同名 Secret，不会覆盖", target, source)
+	}
+	if existing.Type != secret.Type {
+		return fmt.Errorf("命名空间 %s 中的副本类型 %s 与源 Secret 的类型 %s 不一致，Secret 类型不可修改", target, existing.Type, secret.Type)
+	}
+	if existing.Labels[mirrorSourceUIDLabel] == string(secret.UID) && equalSecretData(existing.Data, secret.Data) {
+		return nil
+	}
+
+	klog.InfoS("updating mirrored secret", "source", source, "namespace", target)
+	before := existing.DeepCopy()
+	existing.Labels = desired.Labels
+	existing.Data = desired.Data
+	return guardedWrite(r.dryRun, "update mirrored secret in "+target, key, before, func() (runtime.Object, error) {
+		return copies.Update(ctx, existing, metav1.UpdateOptions{})
+	})
+}
+
+// pruneCopies 函数删除 secret 的所有副本中命名空间不在 keep 中的副本，keep 为 nil 时删除所有副本
+func (r *SecretMirrorReconciler) pruneCopies(ctx context.Context, client clientset.Interface, key string, secret *corev1.Secret, keep sets.Set[string]) error {
+	selector := labels.SelectorFromSet(labels.Set{mirrorSourceUIDLabel: string(secret.UID)})
+	list, err := client.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return err
+	}
+	for i := range list.Items {
+		c := &list.Items[i]
+		if keep.Has(c.Namespace) {
+			continue
+		}
+		if err := r.deleteCopy(ctx, client, key, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteCopy 函数删除一个副本，副本已经不存在时视为成功
+func (r *SecretMirrorReconciler) deleteCopy(ctx context.Context, client clientset.Interface, key string, c *corev1.Secret) error {
+	klog.InfoS("deleting mirrored secret", "source", c.Annotations[mirroredFromAnnotation], "namespace", c.Namespace)
+	return guardedWrite(r.dryRun, "delete mirrored secret in "+c.Namespace, key, c, func() (runtime.Object, error) {
+		err := client.CoreV1().Secrets(c.Namespace).Delete(ctx, c.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &c.UID},
+		})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	})
+}
+
+// CollectOrphans 删除 namespace 中源 Secret 已经不存在的副本，例如控制器停止期间源 Secret 的 finalizer 被手动移除的情况。
+func (r *SecretMirrorReconciler) CollectOrphans(ctx context.Context, cluster, namespace string) error {
+	client := r.clusters.Client(cluster)
+	list, err := client.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: mirrorSourceUIDLabel})
+	if err != nil {
+		return err
+	}
+	for i := range list.Items {
+		c := &list.Items[i]
+		sourceNamespace, sourceName, err := cache.SplitMetaNamespaceKey(c.Annotations[mirroredFromAnnotation])
+		if err != nil || sourceName == "" {
+			continue
+		}
+		if namespace != metav1.NamespaceAll && sourceNamespace != namespace {
+			continue
+		}
+		source, err := client.CoreV1().Secrets(sourceNamespace).Get(ctx, sourceName, metav1.GetOptions{})
+		if err == nil && string(source.UID) == c.Labels[mirrorSourceUIDLabel] {
+			continue
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		if err := r.deleteCopy(ctx, client, c.Annotations[mirroredFromAnnotation], c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// equalSecretData 返回两个 Secret 的数据是否相同
+func equalSecretData(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		w, ok := b[k]
+		if !ok || string(v) != string(w) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog/v2"
+)
+
+// minLeaseServerVersion 是提供 coordination.k8s.io/v1 Lease API 的最低 Kubernetes 版本
+var minLeaseServerVersion = utilversion.MajorMinor(1, 14)
+
+// parseServerVersion 函数解析 --require-min-server-version，s 为空时返回 nil
+func parseServerVersion(s string) (*utilversion.Version, error) {
+	if s == "" {
+		return nil, nil
+	}
+	v, err := utilversion.ParseGeneric(s)
+	if err != nil {
+		return nil, fmt.Errorf("require-min-server-version 格式错误: %w", err)
+	}
+	return v, nil
+}
+
+// checkServerVersion 函数查询 API Server 的版本，低于 minLeaseServerVersion 时输出警告，
+// required 不为 nil 且 API Server 低于该版本或无法确定版本时返回错误。
+// 返回 API Server 是否提供 coordination.k8s.io/v1 的 Lease，以 discovery 的结果为准，因为发行版的版本号不一定可靠。
+func checkServerVersion(client discovery.DiscoveryInterface, required *utilversion.Version) (leaseV1 bool, err error) {
+	info, err := client.ServerVersion()
+	if err != nil {
+		if required != nil {
+			return false, fmt.Errorf("查询 API Server 版本失败: %w", err)
+		}
+		klog.ErrorS(err, "failed to query API server version")
+	} else {
+		serverVersion, err := utilversion.ParseGeneric(info.GitVersion)
+		switch {
+		case err != nil && required != nil:
+			return false, fmt.Errorf("无法解析 API Server 版本 %q: %w", info.GitVersion, err)
+		case err != nil:
+			klog.ErrorS(err, "failed to parse API server version", "version", info.GitVersion)
+		case required != nil && serverVersion.LessThan(required):
+			return false, fmt.Errorf("API Server 版本 %s 低于 --require-min-server-version 要求的 %s", info.GitVersion, required)
+		case serverVersion.LessThan(minLeaseServerVersion):
+			klog.Warningf("API Server 版本 %s 低于 %s，不提供 coordination.k8s.io/v1 的 Lease", info.GitVersion, minLeaseServerVersion)
+		default:
+			klog.InfoS("API server version", "version", info.GitVersion)
+		}
+	}
+
+	leaseV1, err = resourceServed(client, coordinationv1.SchemeGroupVersion.WithResource("leases"))
+	if err != nil {
+		// 无法确认时假定 Lease 可用，由后续的选举报告具体的错误
+		klog.ErrorS(err, "failed to discover lease API")
+		return true, nil
+	}
+	return leaseV1, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+// shardLeaderStatus 表示当前实例是否持有某个分片的领导权
+var shardLeaderStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "controller_shard_leader_status",
+	Help: "当前实例是否持有分片的领导权（1 为持有，0 为未持有）",
+}, []string{"id", "shard"})
+
+func init() {
+	prometheus.MustRegister(shardLeaderStatus)
+}
+
+// shardFor 函数使用跳跃一致性哈希（jump consistent hash）将 key 映射到 [0, count) 中的一个分片。
+// 分片数量变化时只有约 1/count 的 key 会被重新分配。
+func shardFor(key string, count int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	k := h.Sum64()
+	b, j := int64(-1), int64(0)
+	for j < int64(count) {
+		b = j
+		k = k*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((k>>33)+1)))
+	}
+	return int(b)
+}
+
+// shardLeaseName 函数返回分片 shard 使用的锁名称
+func shardLeaseName(name string, shard int) string {
+	return fmt.Sprintf("%s-%d", name, shard)
+}
+
+// parseShards 函数解析 --shards 参数，返回排序后的分片编号；spec 为空时返回所有分片。
+func parseShards(spec string, count int) ([]int, error) {
+	items := splitList(spec)
+	if len(items) == 0 {
+		shards := make([]int, count)
+		for i := range shards {
+			shards[i] = i
+		}
+		return shards, nil
+	}
+	seen := map[int]bool{}
+	shards := make([]int, 0, len(items))
+	for _, item := range items {
+		shard, err := strconv.Atoi(item)
+		if err != nil || shard < 0 || shard >= count {
+			return nil, fmt.Errorf("分片编号 %q 不合法，应为 0 到 %d 之间的整数", item, count-1)
+		}
+		if !seen[shard] {
+			seen[shard] = true
+			shards = append(shards, shard)
+		}
+	}
+	sort.Ints(shards)
+	return shards, nil
+}
+
+// shardSet 记录当前实例持有领导权的分片，控制器只处理属于这些分片的 key
+type shardSet struct {
+	count int
+	mu    sync.RWMutex
+	held  map[int]bool
+}
+
+// newShardSet 函数创建一个共有 count 个分片、尚未持有任何分片的 shardSet
+func newShardSet(count int) *shardSet {
+	return &shardSet{count: count, held: map[int]bool{}}
+}
+
+// owns 函数返回 key 所属的分片是否由当前实例持有
+func (s *shardSet) owns(key string) bool {
+	shard := shardFor(key, s.count)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.held[shard]
+}
+
+// set 函数记录当前实例是否持有 shard
+func (s *shardSet) set(shard int, held bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if held {
+		s.held[shard] = true
+	} else {
+		delete(s.held, shard)
+	}
+}
+
+// shardElectionConfig 是分片选举的配置，各个分片使用相同的租约时间参数
+type shardElectionConfig struct {
+	id              string
+	leaseDuration   time.Duration
+	renewDeadline   time.Duration
+	retryPeriod     time.Duration
+	releaseOnCancel bool
+	// newLock 创建分片 shard 使用的资源锁
+	newLock func(shard int) (resourcelock.Interface, error)
+	// onAcquired 和 onLost 在获得和失去某个分片的领导权时调用
+	onAcquired func(shard int)
+	onLost     func(shard int)
+}
+
+// runShardElections 函数为 shards 中的每个分片各运行一个领导者选举，失去某个分片的领导权后重新参与该分片的竞选，
+// 阻塞直到 ctx 取消且所有选举都已结束。
+func runShardElections(ctx context.Context, shards []int, cfg shardElectionConfig) error {
+	locks := make(map[int]resourcelock.Interface, len(shards))
+	for _, shard := range shards {
+		lock, err := cfg.newLock(shard)
+		if err != nil {
+			return err
+		}
+		locks[shard] = timedLock{lock}
+	}
+
+	var wg sync.WaitGroup
+	for _, shard := range shards {
+		shard, lock := shard, locks[shard]
+		shardLabel := strconv.Itoa(shard)
+		shardLeaderStatus.WithLabelValues(cfg.id, shardLabel).Set(0)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				acquired := false
+				leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+					Lock:            lock,
+					Name:            lock.Describe(),
+					ReleaseOnCancel: cfg.releaseOnCancel,
+					LeaseDuration:   cfg.leaseDuration,
+					RenewDeadline:   cfg.renewDeadline,
+					RetryPeriod:     cfg.retryPeriod,
+					Callbacks: leaderelection.LeaderCallbacks{
+						OnStartedLeading: func(ctx context.Context) {
+							klog.InfoS("acquired shard", "id", cfg.id, "shard", shard, "lock", lock.Describe())
+							shardLeaderStatus.WithLabelValues(cfg.id, shardLabel).Set(1)
+							acquired = true
+							cfg.onAcquired(shard)
+							<-ctx.Done()
+						},
+						OnStoppedLeading: func() {
+							// 未获得过领导权时选举结束同样会调用 OnStoppedLeading
+							if !acquired {
+								return
+							}
+							klog.InfoS("lost shard", "id", cfg.id, "shard", shard, "lock", lock.Describe())
+							shardLeaderStatus.WithLabelValues(cfg.id, shardLabel).Set(0)
+							cfg.onLost(shard)
+						},
+					},
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
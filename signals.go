@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// shutdownSignalNames 为 --shutdown-signals 支持的信号
+var shutdownSignalNames = map[string]os.Signal{
+	"SIGTERM": syscall.SIGTERM,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+// parseSignals 函数解析逗号分隔的信号名称列表（例如 SIGTERM,SIGINT），信号名称不区分大小写，可以省略 SIG 前缀。
+func parseSignals(s string) ([]os.Signal, error) {
+	var signals []os.Signal
+	for _, name := range splitList(s) {
+		name = strings.ToUpper(name)
+		if !strings.HasPrefix(name, "SIG") {
+			name = "SIG" + name
+		}
+		sig, ok := shutdownSignalNames[name]
+		if !ok {
+			supported := make([]string, 0, len(shutdownSignalNames))
+			for n := range shutdownSignalNames {
+				supported = append(supported, n)
+			}
+			sort.Strings(supported)
+			return nil, fmt.Errorf("不支持的信号 %q，可选值为 %s", name, strings.Join(supported, ","))
+		}
+		signals = append(signals, sig)
+	}
+	if len(signals) == 0 {
+		return nil, fmt.Errorf("至少需要指定一个终止信号")
+	}
+	return signals, nil
+}
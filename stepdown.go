@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+// stepdownHandler 函数返回 POST /stepdown 的处理函数，请求需要携带 Authorization: Bearer <token>。
+// 当前实例是领导者时向 requests 发送一个让出领导权的请求并返回 202，不是领导者或已经在让出领导权时返回 409。
+func stepdownHandler(token string, leading func() bool, requests chan<- struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !leading() {
+			http.Error(w, "not the leader", http.StatusConflict)
+			return
+		}
+		select {
+		case requests <- struct{}{}:
+		default:
+			http.Error(w, "stepdown already in progress", http.StatusConflict)
+			return
+		}
+		klog.InfoS("manual stepdown requested", "remoteAddr", r.RemoteAddr)
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// releaseAfterStepdown 函数在主动让出领导权、选举结束之后调用：锁对象仍以 id 为持有者时清空持有者
+// （未开启 --leader-election-release-on-cancel 时选举不会释放租约），然后等待其他副本接管，最多等待 timeout。
+// 返回 false 表示等待期间 ctx 被取消，不应再参与选举。
+func releaseAfterStepdown(ctx context.Context, lock resourcelock.Interface, id string, timeout, interval time.Duration) bool {
+	record, _, err := lock.Get(ctx)
+	if err == nil && record.HolderIdentity == id {
+		now := metav1.NewTime(time.Now())
+		err = lock.Update(ctx, resourcelock.LeaderElectionRecord{
+			LeaderTransitions:    record.LeaderTransitions,
+			LeaseDurationSeconds: 1,
+			RenewTime:            now,
+			AcquireTime:          now,
+		})
+	}
+	if err != nil {
+		klog.ErrorS(err, "failed to release lease after stepdown", "lock", lock.Describe())
+	}
+
+	var leader string
+	err = wait.PollUntilContextTimeout(ctx, interval, timeout, false, func(ctx context.Context) (bool, error) {
+		record, _, err := lock.Get(ctx)
+		if err != nil {
+			return false, nil
+		}
+		leader = record.HolderIdentity
+		return leader != "" && leader != id, nil
+	})
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		klog.InfoS("no other replica took over after stepdown, resuming candidacy", "id", id, "waited", timeout)
+	} else {
+		klog.InfoS("leadership taken over after stepdown, resuming candidacy", "id", id, "leader", leader)
+	}
+	return true
+}
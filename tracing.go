@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName 是控制器创建 span 时使用的 tracer 名称
+const tracerName = "github.com/hewenyu/first-controller"
+
+// setupTracing 函数配置全局 TracerProvider：endpoint 不为空时通过 OTLP gRPC 导出 span，
+// 为空时安装 no-op 实现，不产生任何开销。返回的函数用于退出前导出剩余的 span。
+// 传输安全等其他选项可以通过 OTEL_EXPORTER_OTLP_* 环境变量配置。
+func setupTracing(ctx context.Context, endpoint, id string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	res := resource.NewSchemaless(
+		attribute.String("service.name", controllerName),
+		attribute.String("service.version", version),
+		attribute.String("service.instance.id", id),
+	)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// tracer 函数返回控制器使用的 tracer
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 构建信息，通过 -ldflags 注入，例如：
+//
+//	go build -ldflags "-X main.version=v0.1.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
+// buildInfo 以标签的形式暴露构建信息，值恒为 1
+var buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "controller_build_info",
+	Help: "控制器构建信息，值恒为 1",
+}, []string{"version", "commit", "build_date"})
+
+func init() {
+	if version == "" {
+		version = "dev"
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	if buildDate == "" {
+		buildDate = "unknown"
+	}
+	prometheus.MustRegister(buildInfo)
+	buildInfo.WithLabelValues(version, commit, buildDate).Set(1)
+}
+
+// versionString 函数返回可读的构建信息
+func versionString() string {
+	return fmt.Sprintf("%s version %s (commit %s, built %s)", controllerName, version, commit, buildDate)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// watchErrors 统计 informer 的 list/watch 错误次数
+var watchErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "controller_watch_errors_total",
+	Help: "informer 的 list/watch 错误次数",
+}, []string{"resource"})
+
+// informerRestarts 统计因 list/watch 错误持续过久而重建 informer 的次数
+var informerRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "controller_informer_restarts_total",
+	Help: "因 list/watch 错误持续超过 --informer-max-error-duration 而重建 informer 的次数",
+}, []string{"resource"})
+
+func init() {
+	prometheus.MustRegister(watchErrors, informerRestarts)
+}
+
+// watchErrorTracker 记录所有 informer 最近的 list/watch 错误，替代 cache.DefaultWatchErrorHandler：
+// 以结构化日志记录错误并更新 controller_watch_errors_total，window 内的错误次数达到 threshold 时认为 watch 不健康。
+type watchErrorTracker struct {
+	// threshold 为 0 时只记录错误，始终认为 watch 健康
+	threshold int
+	window    time.Duration
+
+	mu     sync.Mutex
+	recent []time.Time
+}
+
+// newWatchErrorTracker 函数创建一个 window 内错误次数达到 threshold 时报告不健康的 watchErrorTracker
+func newWatchErrorTracker(threshold int, window time.Duration) *watchErrorTracker {
+	return &watchErrorTracker{threshold: threshold, window: window}
+}
+
+// handler 函数返回 resource 的 informer 使用的 WatchErrorHandler，onError 不为 nil 时在每次非正常的错误之后调用
+func (t *watchErrorTracker) handler(cluster, resource string, onError func(at time.Time)) cache.WatchErrorHandler {
+	return func(_ *cache.Reflector, err error) {
+		switch {
+		case errors.Is(err, io.EOF):
+			// watch 正常关闭，reflector 会重新建立 watch
+			return
+		case apierrors.IsResourceExpired(err) || apierrors.IsGone(err):
+			// resourceVersion 过期，reflector 会重新 list，属于正常情况
+			logV(componentInformer, 4).InfoS("watch expired, relisting", "cluster", cluster, "resource", resource, "err", err)
+			return
+		}
+		watchErrors.WithLabelValues(resource).Inc()
+		klog.ErrorS(err, "informer watch failed", "cluster", cluster, "resource", resource)
+		now := time.Now()
+		t.record(now)
+		if onError != nil {
+			onError(now)
+		}
+	}
+}
+
+// record 函数记录一次发生在 at 的错误，并丢弃 window 之外的记录
+func (t *watchErrorTracker) record(at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recent = append(t.prune(at), at)
+}
+
+// prune 函数返回 window 之内的错误记录，调用方需要持有 t.mu
+func (t *watchErrorTracker) prune(now time.Time) []time.Time {
+	cutoff := now.Add(-t.window)
+	i := 0
+	for i < len(t.recent) && t.recent[i].Before(cutoff) {
+		i++
+	}
+	return t.recent[i:]
+}
+
+// healthy 返回 window 内的错误次数是否低于 threshold
+func (t *watchErrorTracker) healthy() bool {
+	if t.threshold <= 0 {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recent = t.prune(time.Now())
+	return len(t.recent) < t.threshold
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// maxAdmissionReviewBytes 为 AdmissionReview 请求体的最大字节数
+const maxAdmissionReviewBytes = 1 << 20
+
+// Validator 校验一个准入请求，返回 nil 表示允许，返回错误表示拒绝，错误信息会返回给 API Server。
+type Validator func(ctx context.Context, req *admissionv1.AdmissionRequest) error
+
+// AdmissionValidator 可以由 Reconciler 实现，用于为 /validate 提供校验逻辑；未实现时允许所有请求。
+type AdmissionValidator interface {
+	Validate(ctx context.Context, req *admissionv1.AdmissionRequest) error
+}
+
+// validatorFor 函数返回 reconciler 对应的 Validator。
+func validatorFor(reconciler Reconciler) Validator {
+	if v, ok := reconciler.(AdmissionValidator); ok {
+		return v.Validate
+	}
+	return func(context.Context, *admissionv1.AdmissionRequest) error {
+		return nil
+	}
+}
+
+// startWebhookServer 函数启动一个 HTTPS 服务，在 /validate 上处理 ValidatingWebhook 的 AdmissionReview 请求，
+// defaulter 不为 nil 时在 /mutate 上处理 MutatingWebhook 的请求，并在 ctx 取消时关闭服务。返回的 channel 在服务关闭完成后关闭。
+func startWebhookServer(ctx context.Context, addr, certFile, keyFile string, validate Validator, defaulter Defaulter) <-chan struct{} {
+	mux := http.NewServeMux()
+	mux.Handle("/validate", validateHandler(validate))
+	if defaulter != nil {
+		mux.Handle("/mutate", mutateHandler(defaulter))
+	}
+	return serveHTTPS(ctx, "webhook", addr, certFile, keyFile, mux)
+}
+
+// validateHandler 函数返回处理 ValidatingWebhook 的 AdmissionReview 的 http.Handler：调用 validate，返回错误时拒绝请求。
+func validateHandler(validate Validator) http.Handler {
+	return admissionHandler(func(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+		if err := validate(ctx, req); err != nil {
+			klog.InfoS("admission request denied", "kind", req.Kind.Kind, "namespace", req.Namespace, "name", req.Name, "reason", err.Error())
+			return deniedResponse(req, http.StatusForbidden, metav1.StatusReasonForbidden, err)
+		}
+		return &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	})
+}
+
+// deniedResponse 函数返回拒绝 req 的 AdmissionResponse，err 的信息会返回给 API Server
+func deniedResponse(req *admissionv1.AdmissionRequest, code int32, reason metav1.StatusReason, err error) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		UID:     req.UID,
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: err.Error(),
+			Reason:  reason,
+			Code:    code,
+		},
+	}
+}
+
+// admissionHandler 函数返回处理 AdmissionReview 的 http.Handler：解码请求，调用 handle，并将返回的响应写回。
+func admissionHandler(handle func(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var review admissionv1.AdmissionReview
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdmissionReviewBytes)).Decode(&review); err != nil {
+			http.Error(w, "invalid AdmissionReview: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if review.Request == nil {
+			http.Error(w, "AdmissionReview has no request", http.StatusBadRequest)
+			return
+		}
+
+		// 响应必须使用与请求相同的 apiVersion 和 kind
+		review.Response = handle(r.Context(), review.Request)
+		review.Request = nil
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(&review); err != nil {
+			klog.Errorf("写入 AdmissionReview 响应失败: %v", err)
+		}
+	})
+}
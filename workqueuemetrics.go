@@ -0,0 +1,86 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// workqueueName 是控制器工作队列的名称，client-go 只为有名称的队列记录指标，指标的 name 标签即为该名称
+const workqueueName = "controller"
+
+var (
+	workqueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "controller_workqueue_depth",
+		Help: "工作队列中等待处理的 key 数量",
+	}, []string{"name"})
+
+	workqueueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "controller_workqueue_adds_total",
+		Help: "加入工作队列的 key 数量",
+	}, []string{"name"})
+
+	workqueueQueueDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "controller_workqueue_queue_duration_seconds",
+		Help:    "key 从加入工作队列到开始处理的等待时间",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"name"})
+
+	workqueueWorkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "controller_workqueue_work_duration_seconds",
+		Help:    "从工作队列取出的 key 的处理时间",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"name"})
+
+	workqueueUnfinishedWork = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "controller_workqueue_unfinished_work_seconds",
+		Help: "正在处理且尚未完成的 key 已经处理的总时间，持续增长说明 worker 可能被卡住",
+	}, []string{"name"})
+
+	workqueueLongestRunningProcessor = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "controller_workqueue_longest_running_processor_seconds",
+		Help: "处理时间最长的 key 已经处理的时间",
+	}, []string{"name"})
+
+	workqueueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "controller_workqueue_retries_total",
+		Help: "工作队列中 key 的限速重试次数",
+	}, []string{"name"})
+)
+
+func init() {
+	prometheus.MustRegister(workqueueDepth, workqueueAdds, workqueueQueueDuration, workqueueWorkDuration,
+		workqueueUnfinishedWork, workqueueLongestRunningProcessor, workqueueRetries)
+	// SetProvider 只有第一次调用生效，且必须在创建队列之前调用，因此在 init 中注册
+	workqueue.SetProvider(workqueueMetricsProvider{})
+}
+
+// workqueueMetricsProvider 实现 workqueue.MetricsProvider，将 client-go 工作队列的指标导出到 Prometheus
+type workqueueMetricsProvider struct{}
+
+func (workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workqueueDepth.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workqueueAdds.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return workqueueQueueDuration.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return workqueueWorkDuration.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueUnfinishedWork.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueLongestRunningProcessor.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workqueueRetries.WithLabelValues(name)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// writeAccessGuard 跟踪写操作连续返回 403 Forbidden 的次数。连续次数达到 threshold 时认为写权限已经丢失（例如凭据被轮换），
+// 进入只读模式：informer 缓存、指标和健康检查照常工作，但 guardedWrite 跳过所有写操作，避免 RBAC 临时配置错误时不断失败重试。
+type writeAccessGuard struct {
+	// threshold 为进入只读模式前允许的连续 Forbidden 次数，为 0 时关闭该功能
+	threshold int32
+	// onLost 在进入只读模式时调用，err 为最后一次写操作返回的错误
+	onLost func(err error)
+
+	forbidden atomic.Int32
+	readOnly  atomic.Bool
+}
+
+// writeAccess 是 guardedWrite 使用的写权限状态，由 realMain 根据命令行参数配置
+var writeAccess = &writeAccessGuard{}
+
+// configure 函数设置进入只读模式的阈值和回调，并将 controller_write_access 指标初始化为 1
+func (g *writeAccessGuard) configure(threshold int, onLost func(err error)) {
+	g.threshold = int32(threshold)
+	g.onLost = onLost
+	controllerWriteAccess.Set(1)
+}
+
+// degraded 函数返回当前是否处于只读模式
+func (g *writeAccessGuard) degraded() bool {
+	return g.readOnly.Load()
+}
+
+// observe 函数记录一次写操作的结果：Forbidden 时累加计数并在达到阈值时进入只读模式，成功时清零计数。
+func (g *writeAccessGuard) observe(err error) {
+	if g.threshold <= 0 {
+		return
+	}
+	if !apierrors.IsForbidden(err) {
+		if err == nil {
+			g.forbidden.Store(0)
+		}
+		return
+	}
+	if g.forbidden.Add(1) < g.threshold || !g.readOnly.CompareAndSwap(false, true) {
+		return
+	}
+	controllerWriteAccess.Set(0)
+	klog.ErrorS(err, "degraded: write access lost, switching to read-only mode", "consecutiveForbidden", g.threshold)
+	if g.onLost != nil {
+		g.onLost(err)
+	}
+}
+
+// restore 函数退出只读模式
+func (g *writeAccessGuard) restore() {
+	g.forbidden.Store(0)
+	g.readOnly.Store(false)
+	controllerWriteAccess.Set(1)
+	klog.Info("write access restored, leaving read-only mode")
+}
+
+// watchWriteAccess 函数在只读模式下每隔 interval 通过 SelfSubjectAccessReview 检查 reconciler 所需的权限，
+// 所有集群的权限都恢复后退出只读模式并调用 onRestored，直到 ctx 取消。
+func watchWriteAccess(ctx context.Context, clusters *clusterSet, reconciler Reconciler, namespace string, interval time.Duration, onRestored func()) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if !writeAccess.degraded() {
+			return
+		}
+		for _, cluster := range clusters.names {
+			denied, err := checkPermissions(ctx, clusters.Client(cluster), watchPermissions(reconciler, namespace))
+			if err != nil {
+				klog.ErrorS(err, "failed to check write access", "cluster", cluster)
+				return
+			}
+			if len(denied) > 0 {
+				logV(componentReconcile, 2).InfoS("write access still denied", "cluster", cluster, "denied", denied)
+				return
+			}
+		}
+		writeAccess.restore()
+		if onRestored != nil {
+			onRestored()
+		}
+	}, interval)
+}